@@ -2,27 +2,55 @@ package main
 
 import (
 	"cartService/internal/app/grpcapp"
+	"cartService/internal/audit"
+	"cartService/internal/auth"
+	"cartService/internal/cache"
+	"cartService/internal/clients/breaker"
+	"cartService/internal/clients/conn"
+	"cartService/internal/clients/credentials"
+	"cartService/internal/clients/retry"
 	crtgrpc "cartService/internal/clients/subscriptions/grpc"
 	"cartService/internal/clients/toys/grpc"
+	"cartService/internal/data"
+	admingrpc "cartService/internal/grpc/admin"
+	"cartService/internal/health"
 	"cartService/internal/jsonlog"
+	"cartService/internal/ratelimit"
+	"cartService/internal/services/admin"
 	"cartService/internal/services/cart"
+	"cartService/internal/tlsconfig"
+	"cartService/internal/tracing"
+	"cartService/storage/cached"
+	"cartService/storage/memory"
 	"cartService/storage/postgres"
 	"context"
+	"crypto/tls"
+	"expvar"
 	"flag"
 	"fmt"
 	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	_ "github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
 	_ "github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
+	"github.com/spacecowboytobykty123/toysProto/gen/go/toys"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
 	_ "google.golang.org/grpc"
 	grpc2 "google.golang.org/grpc"
+	grpccreds "google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	_ "google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/grpclog"
+	"gopkg.in/yaml.v3"
+	"io"
+	"log/slog"
 	"net/http"
 	_ "net/http"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -34,79 +62,377 @@ type StorageDetails struct {
 	MaxOpenConns int
 	MaxIdleConns int
 	MaxIdleTime  string
+	AutoMigrate  bool
+	// MigrateTimeout bounds the startup migrations, waiting for the lock included.
+	MigrateTimeout time.Duration
 }
 
 type Client struct {
-	Address      int           `yaml:"address"`
-	Timeout      time.Duration `yaml:"timeout"`
-	RetriesCount int           `yaml:"retries_count"`
-	insecure     bool          `yaml:"insecure"`
+	Conn conn.Config `yaml:"conn"`
+	// Retry.Default comes from the -*-client-retry-* flags; per-method policies come
+	// from -retry-policy-file.
+	Retry retry.Config `yaml:"retry"`
+	// Breaker trips when the service keeps failing; a zero FailureRate disables it.
+	Breaker breaker.Config `yaml:"breaker"`
+	// Insecure dials in plaintext; otherwise TLS is used with the certificates in TLS.
+	Insecure bool             `yaml:"insecure"`
+	TLS      tlsconfig.Config `yaml:"tls"`
+	// Credentials selects how outgoing calls authenticate (forward|service|exchange).
+	Credentials string `yaml:"credentials"`
+	// Audience is put into service tokens and requested from the token exchange.
+	Audience string `yaml:"audience"`
+}
+
+type ServiceTokenConfig struct {
+	Secret  string
+	KeyFile string
+	KeyID   string
+	Issuer  string
+	Subject string
+	TTL     time.Duration
+}
+
+type TokenExchangeConfig struct {
+	URL          string
+	ClientID     string
+	ClientSecret string
+	Scope        string
+	Timeout      time.Duration
+}
+
+type CacheConfig struct {
+	Backend       string
+	TTL           time.Duration
+	LRUSize       int
+	RedisAddr     string
+	RedisPassword string
+	RedisDB       int
 }
 
 type ClientsConfig struct {
-	Subs Client `yaml:"subs"`
-	Toys Client `yaml:"toys"`
+	Subs      Client              `yaml:"subs"`
+	Toys      Client              `yaml:"toys"`
+	SubsCache crtgrpc.CacheConfig `yaml:"subs_cache"`
+	ToysCache grpc.CacheConfig    `yaml:"toys_cache"`
+
+	// RetryPolicyFile is a YAML file with per-method retry policies of both clients.
+	RetryPolicyFile string
+
+	ServiceToken  ServiceTokenConfig  `yaml:"service_token"`
+	TokenExchange TokenExchangeConfig `yaml:"token_exchange"`
 }
 
 type GRPCConfig struct {
 	Port    int
 	Timeout time.Duration
+	// TLS enables TLS on the server when a certificate is set, and mutual TLS when a
+	// client CA is set as well.
+	TLS tlsconfig.Config
+	// GatewayTLS is the client side of the HTTP gateway's connection to the server.
+	GatewayTLS tlsconfig.Config
+	TLSReload  time.Duration
+}
+
+type JWTConfig struct {
+	JWKSFile   string
+	JWKSReload time.Duration
+	Algorithms string
+	Issuer     string
+	Audience   string
+	Leeway     time.Duration
+}
+
+type RateLimitConfig struct {
+	Limits   string
+	Backend  string
+	FailOpen bool
+}
+
+type HealthConfig struct {
+	Interval time.Duration
+	Timeout  time.Duration
+	// Required lists the dependencies (storage, subscriptions, toys) that make the
+	// service unready when they fail; the others are only reported.
+	Required string
 }
 
 type Config struct {
 	env       string
+	Storage   string
 	DB        StorageDetails
+	Cache     CacheConfig
 	GRPC      GRPCConfig
 	TokenTTL  time.Duration
 	Clients   ClientsConfig
 	AppSecret string
+	JWT       JWTConfig
+	AuditLog  string
+	RateLimit RateLimitConfig
+	// SubsPolicy overrides the per-operation fail modes of the default subscription
+	// check policy.
+	SubsPolicy      string
+	SubsPolicyGrace time.Duration
+	Health          HealthConfig
+	Tracing         tracing.Config
+	// LogRedactKeys lists property names redacted in addition to the defaults.
+	LogRedactKeys string
+	LogLevel      jsonlog.Level
+	// LogStackLevel is the lowest level whose entries carry a stack trace.
+	LogStackLevel jsonlog.Level
+	LogSampling   jsonlog.SamplingConfig
+	// GRPCLogVerbosity is the verbosity of the gRPC library's own logs.
+	GRPCLogVerbosity int
+	// AdminAddr serves the expvar and Prometheus metrics; they expose the command line
+	// and internals, so it must not be reachable from outside.
+	AdminAddr string
 }
 
 type Application struct {
-	GRPCSrv *grpcapp.App
+	GRPCSrv  *grpcapp.App
+	Health   *health.Monitor
+	Verifier *auth.Verifier
 }
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		os.Exit(runMigrate(os.Args[2:]))
+	}
+
 	var cfg Config
+	var toysHedgeDelay time.Duration
 
 	flag.StringVar(&cfg.env, "env", "development", "Environment (development|staging|production)")
-	host := os.Getenv("DB_HOST")
-	port := os.Getenv("DB_PORT")
-	user := os.Getenv("DB_USER")
-	pass := os.Getenv("DB_PASSWORD")
-	name := os.Getenv("DB_NAME")
+	flag.StringVar(&cfg.Storage, "storage", "postgres", "Cart storage backend (postgres|memory)")
 
-	dsn := fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&client_encoding=UTF8", user, pass, host, port, name)
-
-	flag.StringVar(&cfg.DB.DSN, "db-dsn", dsn, "PostgresSQL DSN")
+	flag.StringVar(&cfg.DB.DSN, "db-dsn", envDSN(), "PostgresSQL DSN")
 	flag.IntVar(&cfg.DB.MaxOpenConns, "db-max-open-conns", 25, "PostgresSQL max open connections")
 	flag.IntVar(&cfg.DB.MaxIdleConns, "db-max-Idle-conns", 25, "PostgresSQL max Idle connections")
 	flag.StringVar(&cfg.DB.MaxIdleTime, "db-max-Idle-time", "15m", "PostgresSQl max Idle time")
+	flag.BoolVar(&cfg.DB.AutoMigrate, "db-auto-migrate", true, "Apply embedded schema migrations on startup")
+	flag.DurationVar(&cfg.DB.MigrateTimeout, "db-migrate-timeout", 5*time.Minute, "Maximum time startup migrations may take, waiting for the migration lock included")
+
+	flag.StringVar(&cfg.Cache.Backend, "cache", "none", "GetCart cache backend (none|lru|redis)")
+	flag.DurationVar(&cfg.Cache.TTL, "cache-ttl", 30*time.Second, "GetCart cache entry TTL")
+	flag.IntVar(&cfg.Cache.LRUSize, "cache-lru-size", 10000, "Maximum number of carts kept by the lru cache")
+	flag.StringVar(&cfg.Cache.RedisAddr, "cache-redis-addr", "localhost:6379", "Redis compatible server address")
+	flag.StringVar(&cfg.Cache.RedisPassword, "cache-redis-password", os.Getenv("CACHE_REDIS_PASSWORD"), "Redis compatible server password")
+	flag.IntVar(&cfg.Cache.RedisDB, "cache-redis-db", 0, "Redis database number")
 
 	flag.IntVar(&cfg.GRPC.Port, "grpc-port", 5000, "grpc-port")
+	flag.StringVar(&cfg.GRPC.TLS.CertFile, "grpc-tls-cert", "", "PEM server certificate; enables TLS")
+	flag.StringVar(&cfg.GRPC.TLS.KeyFile, "grpc-tls-key", "", "PEM server private key")
+	flag.StringVar(&cfg.GRPC.TLS.CAFile, "grpc-tls-client-ca", "", "PEM CA bundle client certificates must chain to; enables mutual TLS")
+	flag.Func("grpc-tls-allowed-sans", "Comma separated client certificate SANs allowed to connect (trailing * matches by prefix)", sansFlag(&cfg.GRPC.TLS.AllowedSANs))
+	flag.StringVar(&cfg.GRPC.GatewayTLS.CertFile, "gateway-tls-cert", "", "PEM client certificate the HTTP gateway presents to the gRPC server (default -grpc-tls-cert)")
+	flag.StringVar(&cfg.GRPC.GatewayTLS.KeyFile, "gateway-tls-key", "", "PEM client private key of the HTTP gateway (default -grpc-tls-key)")
+	flag.StringVar(&cfg.GRPC.GatewayTLS.CAFile, "gateway-tls-ca", "", "PEM CA bundle the gRPC server certificate must chain to (default -grpc-tls-client-ca)")
+	flag.StringVar(&cfg.GRPC.GatewayTLS.ServerName, "gateway-tls-server-name", "localhost", "Name the HTTP gateway verifies the gRPC server certificate against")
+	flag.DurationVar(&cfg.GRPC.TLSReload, "tls-reload", time.Minute, "How often certificate files are checked for changes")
 	flag.DurationVar(&cfg.TokenTTL, "token-ttl", time.Hour, "GRPC's work duration")
-	flag.IntVar(&cfg.Clients.Subs.Address, "sub-client-addr", 3000, "sub-port")
-	flag.IntVar(&cfg.Clients.Toys.Address, "toys-client-addr", 9000, "toy-port")
-	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
-	subsClient, err := crtgrpc.New(context.Background(), logger, cfg.Clients.Subs.Address, cfg.Clients.Subs.Timeout, cfg.Clients.Subs.RetriesCount)
-	toyClient, err := grpc.New(context.Background(), logger, cfg.Clients.Subs.Timeout, cfg.Clients.Toys.Address)
+	flag.StringVar(&cfg.AppSecret, "jwt-secret", os.Getenv("JWT_SECRET"), "HMAC secret for tokens without a key id")
+	flag.StringVar(&cfg.JWT.JWKSFile, "jwt-jwks-file", "", "Path to a JWKS file with RSA/EC/oct verification keys")
+	flag.DurationVar(&cfg.JWT.JWKSReload, "jwt-jwks-reload", 30*time.Second, "How often the JWKS file is checked for changes")
+	flag.StringVar(&cfg.JWT.Algorithms, "jwt-algorithms", "HS256,RS256,ES256", "Comma separated list of accepted JWT signing algorithms")
+	flag.StringVar(&cfg.JWT.Issuer, "jwt-issuer", "", "Required JWT issuer (iss), empty to skip the check")
+	flag.StringVar(&cfg.JWT.Audience, "jwt-audience", "", "Required JWT audience (aud), empty to skip the check")
+	flag.DurationVar(&cfg.JWT.Leeway, "jwt-leeway", 30*time.Second, "Allowed clock skew for exp, nbf and iat")
+	flag.StringVar(&cfg.AuditLog, "audit-log", "", "File the admin audit log is appended to (default stdout; entries carry \"type\":\"audit\")")
+
+	flag.StringVar(&cfg.RateLimit.Limits, "rate-limits", "/cart.Cart/AddToCart=2:10,default=20:40", "Per-method token buckets as method=rate:burst, comma separated; empty disables rate limiting")
+	flag.StringVar(&cfg.RateLimit.Backend, "rate-limit-backend", "local", "Where rate limit buckets are kept (local|redis); redis uses the -cache-redis-* settings")
+	flag.BoolVar(&cfg.RateLimit.FailOpen, "rate-limit-fail-open", true, "Allow requests when the rate limit backend is unavailable")
+	flag.StringVar(&cfg.SubsPolicy, "subs-fail-policy", "", "Per-operation behaviour when the subscription check fails as op=open|closed|last-known-good, comma separated (get_cart, watch_cart, add_to_cart, del_from_cart); unset operations use the default: reads open, writes last-known-good")
+	flag.DurationVar(&cfg.SubsPolicyGrace, "subs-fail-grace", 15*time.Minute, "How old a last-known-good subscription may be for last-known-good operations")
+	flag.DurationVar(&cfg.Health.Interval, "health-interval", 10*time.Second, "How often dependencies are checked")
+	flag.DurationVar(&cfg.Health.Timeout, "health-timeout", 2*time.Second, "Timeout of a single dependency check")
+	flag.StringVar(&cfg.Health.Required, "health-required", "storage", "Comma separated dependencies (storage, subscriptions, toys) that must be healthy for readiness")
+	flag.StringVar(&cfg.Tracing.Exporter, "trace-exporter", "none", "Trace exporter (none|otlp|stdout|file)")
+	flag.StringVar(&cfg.Tracing.OTLPEndpoint, "trace-otlp-endpoint", "localhost:4317", "OTLP/gRPC collector host:port")
+	flag.BoolVar(&cfg.Tracing.OTLPInsecure, "trace-otlp-insecure", true, "Send spans to the OTLP collector in plaintext")
+	flag.StringVar(&cfg.Tracing.File, "trace-file", "traces.jsonl", "File spans are appended to with -trace-exporter=file")
+	flag.Float64Var(&cfg.Tracing.SampleRatio, "trace-sample-ratio", 1, "Share of new traces recorded, in [0, 1]")
+	flag.StringVar(&cfg.AdminAddr, "admin-addr", "localhost:6060", "Private listener for /metrics and /debug/vars")
+	flag.StringVar(&cfg.LogRedactKeys, "log-redact-keys", "", "Comma separated log property names to redact in addition to the defaults")
+	cfg.LogStackLevel = jsonlog.LevelError
+	flag.Func("log-level", "Lowest level logged (debug|info|warn|error|fatal|off) (default info)", levelFlag(&cfg.LogLevel))
+	flag.Func("log-stack-level", "Lowest level whose entries carry a stack trace (default error, off disables)", levelFlag(&cfg.LogStackLevel))
+	flag.DurationVar(&cfg.LogSampling.Interval, "log-sample-interval", 0, "Interval over which repeated log messages below ERROR are sampled (0 disables sampling)")
+	flag.IntVar(&cfg.LogSampling.First, "log-sample-first", 100, "Entries of one message logged per sampling interval before sampling starts")
+	flag.IntVar(&cfg.LogSampling.Thereafter, "log-sample-thereafter", 100, "Once sampling, log every Nth entry of a message (0 drops the rest)")
+	flag.IntVar(&cfg.GRPCLogVerbosity, "grpc-log-verbosity", 0, "Verbosity of the gRPC library logs, written at DEBUG")
+	flag.StringVar(&cfg.Clients.Subs.Conn.Target, "subs-client-target", "dns:///localhost:3000", "Subscriptions service gRPC target (host:port, dns:///host:port or static:///host1:port,host2:port)")
+	flag.StringVar(&cfg.Clients.Subs.Conn.LoadBalancing, "subs-client-lb", "round_robin", "Subscriptions client load balancing policy (round_robin|pick_first)")
+	flag.DurationVar(&cfg.Clients.Subs.Conn.Keepalive.Time, "subs-client-keepalive-time", 30*time.Second, "Idle time before the subscriptions connection is pinged (0 disables)")
+	flag.DurationVar(&cfg.Clients.Subs.Conn.Keepalive.Timeout, "subs-client-keepalive-timeout", 10*time.Second, "How long to wait for a subscriptions keepalive ack")
+	flag.BoolVar(&cfg.Clients.Subs.Conn.Keepalive.PermitWithoutStream, "subs-client-keepalive-permit-without-stream", false, "Ping the subscriptions service without active calls")
+	flag.DurationVar(&cfg.Clients.Subs.Retry.Default.PerAttemptTimeout, "subs-client-timeout", 2*time.Second, "Timeout of each subscriptions service call attempt")
+	flag.IntVar(&cfg.Clients.Subs.Retry.Default.MaxAttempts, "subs-client-retries", 3, "Attempts made for a subscriptions service call, the first one included")
+	flag.Func("subs-client-retry-codes", "Comma separated status codes retried on subscriptions calls (default UNAVAILABLE,DEADLINE_EXCEEDED)", codesFlag(&cfg.Clients.Subs.Retry.Default.Codes))
+	flag.DurationVar(&cfg.Clients.Subs.Retry.Default.InitialBackoff, "subs-client-retry-backoff", 100*time.Millisecond, "Wait before the first subscriptions retry; doubles on every further retry")
+	flag.DurationVar(&cfg.Clients.Subs.Retry.Default.MaxBackoff, "subs-client-retry-max-backoff", time.Second, "Longest wait between subscriptions retries")
+	flag.Float64Var(&cfg.Clients.Subs.Retry.Default.Jitter, "subs-client-retry-jitter", 0.2, "Random spread of subscriptions retry waits as a fraction of their length")
+	flag.DurationVar(&cfg.Clients.Subs.Retry.Default.Budget, "subs-client-retry-budget", 5*time.Second, "Time budget of a subscriptions call, all attempts included (0 for none)")
+	flag.Float64Var(&cfg.Clients.Subs.Breaker.FailureRate, "subs-client-breaker-failure-rate", 0.5, "Failure rate that opens the subscriptions circuit breaker (0 disables it)")
+	flag.DurationVar(&cfg.Clients.Subs.Breaker.Window, "subs-client-breaker-window", 30*time.Second, "Window the subscriptions failure rate is computed over")
+	flag.IntVar(&cfg.Clients.Subs.Breaker.MinRequests, "subs-client-breaker-min-requests", 10, "Calls needed in the window before the subscriptions breaker may open")
+	flag.DurationVar(&cfg.Clients.Subs.Breaker.OpenTimeout, "subs-client-breaker-open-timeout", 15*time.Second, "How long the subscriptions breaker stays open before probing")
+	flag.IntVar(&cfg.Clients.Subs.Breaker.HalfOpenRequests, "subs-client-breaker-half-open-requests", 1, "Probe calls that must succeed to close the subscriptions breaker")
+	flag.StringVar(&cfg.Clients.Toys.Conn.Target, "toys-client-target", "dns:///localhost:9000", "Toys service gRPC target (host:port, dns:///host:port or static:///host1:port,host2:port)")
+	flag.StringVar(&cfg.Clients.Toys.Conn.LoadBalancing, "toys-client-lb", "round_robin", "Toys client load balancing policy (round_robin|pick_first)")
+	flag.DurationVar(&cfg.Clients.Toys.Conn.Keepalive.Time, "toys-client-keepalive-time", 30*time.Second, "Idle time before the toys connection is pinged (0 disables)")
+	flag.DurationVar(&cfg.Clients.Toys.Conn.Keepalive.Timeout, "toys-client-keepalive-timeout", 10*time.Second, "How long to wait for a toys keepalive ack")
+	flag.BoolVar(&cfg.Clients.Toys.Conn.Keepalive.PermitWithoutStream, "toys-client-keepalive-permit-without-stream", false, "Ping the toys service without active calls")
+	flag.DurationVar(&cfg.Clients.Toys.Retry.Default.PerAttemptTimeout, "toys-client-timeout", 2*time.Second, "Timeout of each toys service call attempt")
+	flag.IntVar(&cfg.Clients.Toys.Retry.Default.MaxAttempts, "toys-client-retries", 3, "Attempts made for a toys service call, the first one included")
+	flag.Func("toys-client-retry-codes", "Comma separated status codes retried on toys calls (default UNAVAILABLE,DEADLINE_EXCEEDED)", codesFlag(&cfg.Clients.Toys.Retry.Default.Codes))
+	flag.DurationVar(&cfg.Clients.Toys.Retry.Default.InitialBackoff, "toys-client-retry-backoff", 100*time.Millisecond, "Wait before the first toys retry; doubles on every further retry")
+	flag.DurationVar(&cfg.Clients.Toys.Retry.Default.MaxBackoff, "toys-client-retry-max-backoff", time.Second, "Longest wait between toys retries")
+	flag.Float64Var(&cfg.Clients.Toys.Retry.Default.Jitter, "toys-client-retry-jitter", 0.2, "Random spread of toys retry waits as a fraction of their length")
+	flag.DurationVar(&cfg.Clients.Toys.Retry.Default.Budget, "toys-client-retry-budget", 5*time.Second, "Time budget of a toys call, all attempts included (0 for none)")
+	flag.DurationVar(&cfg.Clients.SubsCache.TTL, "subs-cache-ttl", 30*time.Second, "How long a positive subscription check is cached (0 disables)")
+	flag.DurationVar(&cfg.Clients.SubsCache.NegativeTTL, "subs-cache-negative-ttl", 5*time.Second, "How long a negative subscription check is cached (0 disables)")
+	flag.IntVar(&cfg.Clients.SubsCache.MaxEntries, "subs-cache-max-entries", 100000, "Maximum number of cached subscription checks")
+	flag.DurationVar(&cfg.Clients.ToysCache.TTL, "toys-cache-ttl", 5*time.Minute, "How long toy metadata is cached (0 disables)")
+	flag.DurationVar(&cfg.Clients.ToysCache.StaleTTL, "toys-cache-stale-ttl", time.Hour, "How long expired toy metadata may be served while it is refreshed in the background")
+	flag.DurationVar(&cfg.Clients.ToysCache.MaxAge, "toys-cache-max-age", 24*time.Hour, "How long toy metadata is kept as a fallback for when the toys service fails")
+	flag.IntVar(&cfg.Clients.ToysCache.MaxEntries, "toys-cache-max-entries", 10000, "Maximum number of cached toys")
+	flag.IntVar(&cfg.Clients.ToysCache.BatchConcurrency, "toys-batch-concurrency", 8, "Maximum concurrent toys service calls made by a batch lookup")
+
+	flag.BoolVar(&cfg.Clients.Subs.Insecure, "subs-client-insecure", true, "Dial the subscriptions service in plaintext")
+	flag.StringVar(&cfg.Clients.Subs.TLS.CertFile, "subs-client-tls-cert", "", "PEM client certificate presented to the subscriptions service")
+	flag.StringVar(&cfg.Clients.Subs.TLS.KeyFile, "subs-client-tls-key", "", "PEM client private key for the subscriptions service")
+	flag.StringVar(&cfg.Clients.Subs.TLS.CAFile, "subs-client-tls-ca", "", "PEM CA bundle the subscriptions service certificate must chain to (default system roots)")
+	flag.StringVar(&cfg.Clients.Subs.TLS.ServerName, "subs-client-tls-server-name", "", "Override of the name the subscriptions service certificate is verified against")
+	flag.Func("subs-client-tls-allowed-sans", "Comma separated SANs the subscriptions service certificate must carry one of", sansFlag(&cfg.Clients.Subs.TLS.AllowedSANs))
+	flag.BoolVar(&cfg.Clients.Toys.Insecure, "toys-client-insecure", true, "Dial the toys service in plaintext")
+	flag.StringVar(&cfg.Clients.Toys.TLS.CertFile, "toys-client-tls-cert", "", "PEM client certificate presented to the toys service")
+	flag.StringVar(&cfg.Clients.Toys.TLS.KeyFile, "toys-client-tls-key", "", "PEM client private key for the toys service")
+	flag.StringVar(&cfg.Clients.Toys.TLS.CAFile, "toys-client-tls-ca", "", "PEM CA bundle the toys service certificate must chain to (default system roots)")
+	flag.StringVar(&cfg.Clients.Toys.TLS.ServerName, "toys-client-tls-server-name", "", "Override of the name the toys service certificate is verified against")
+	flag.Func("toys-client-tls-allowed-sans", "Comma separated SANs the toys service certificate must carry one of", sansFlag(&cfg.Clients.Toys.TLS.AllowedSANs))
+	flag.DurationVar(&toysHedgeDelay, "toys-client-hedge-delay", 0, "Send another GetToy attempt when none answered within this delay (0 disables hedging)")
+	flag.StringVar(&cfg.Clients.RetryPolicyFile, "retry-policy-file", "", "YAML file with per-method retry policies under subs.methods and toys.methods")
+	flag.Float64Var(&cfg.Clients.Toys.Breaker.FailureRate, "toys-client-breaker-failure-rate", 0.5, "Failure rate that opens the toys circuit breaker (0 disables it)")
+	flag.DurationVar(&cfg.Clients.Toys.Breaker.Window, "toys-client-breaker-window", 30*time.Second, "Window the toys failure rate is computed over")
+	flag.IntVar(&cfg.Clients.Toys.Breaker.MinRequests, "toys-client-breaker-min-requests", 10, "Calls needed in the window before the toys breaker may open")
+	flag.DurationVar(&cfg.Clients.Toys.Breaker.OpenTimeout, "toys-client-breaker-open-timeout", 15*time.Second, "How long the toys breaker stays open before probing")
+	flag.IntVar(&cfg.Clients.Toys.Breaker.HalfOpenRequests, "toys-client-breaker-half-open-requests", 1, "Probe calls that must succeed to close the toys breaker")
+
+	flag.StringVar(&cfg.Clients.Subs.Credentials, "subs-client-credentials", "forward", "How calls to the subscriptions service authenticate (forward|service|exchange)")
+	flag.StringVar(&cfg.Clients.Subs.Audience, "subs-client-audience", "subscriptions", "Audience of service and exchanged tokens sent to the subscriptions service")
+	flag.StringVar(&cfg.Clients.Toys.Credentials, "toys-client-credentials", "forward", "How calls to the toys service authenticate (forward|service|exchange)")
+	flag.StringVar(&cfg.Clients.Toys.Audience, "toys-client-audience", "toys", "Audience of service and exchanged tokens sent to the toys service")
+	flag.StringVar(&cfg.Clients.ServiceToken.Secret, "service-token-secret", os.Getenv("SERVICE_TOKEN_SECRET"), "HMAC secret used to sign service tokens")
+	flag.StringVar(&cfg.Clients.ServiceToken.KeyFile, "service-token-key", "", "PEM RSA/EC private key used to sign service tokens (takes precedence over -service-token-secret)")
+	flag.StringVar(&cfg.Clients.ServiceToken.KeyID, "service-token-kid", "", "Key id (kid) put into the service token header")
+	flag.StringVar(&cfg.Clients.ServiceToken.Issuer, "service-token-issuer", "cart-service", "Issuer (iss) of service tokens")
+	flag.StringVar(&cfg.Clients.ServiceToken.Subject, "service-token-subject", "cart-service", "Subject (sub) of service tokens")
+	flag.DurationVar(&cfg.Clients.ServiceToken.TTL, "service-token-ttl", 5*time.Minute, "Lifetime of service tokens")
+	flag.StringVar(&cfg.Clients.TokenExchange.URL, "token-exchange-url", "", "OAuth 2.0 token endpoint used for token exchange")
+	flag.StringVar(&cfg.Clients.TokenExchange.ClientID, "token-exchange-client-id", "", "Client id used to authenticate to the token endpoint")
+	flag.StringVar(&cfg.Clients.TokenExchange.ClientSecret, "token-exchange-client-secret", os.Getenv("TOKEN_EXCHANGE_CLIENT_SECRET"), "Client secret used to authenticate to the token endpoint")
+	flag.StringVar(&cfg.Clients.TokenExchange.Scope, "token-exchange-scope", "", "Scope requested for exchanged tokens")
+	flag.DurationVar(&cfg.Clients.TokenExchange.Timeout, "token-exchange-timeout", 5*time.Second, "Timeout of token exchange requests")
 
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stdout, cfg.LogLevel)
+	logger.SetStackLevel(cfg.LogStackLevel)
+	logger.SetSampling(&cfg.LogSampling)
+	// The policy is set before anything logs, so the clients and their interceptors
+	// are covered from their first entry.
+	if cfg.LogRedactKeys != "" {
+		policy := jsonlog.DefaultRedactionPolicy()
+		policy.Keys = append(policy.Keys, strings.Split(cfg.LogRedactKeys, ",")...)
+		logger.SetRedactionPolicy(policy)
+	}
+	// slog users, including the standard log package, and gRPC itself log through
+	// logger too. grpclog must be replaced before anything else touches gRPC.
+	slog.SetDefault(slog.New(logger.SlogHandler()))
+	grpclog.SetLoggerV2(jsonlog.GRPCLogger(logger, cfg.GRPCLogVerbosity))
+
+	cfg.Tracing.ServiceName = "cart-service"
+	cfg.Tracing.Version = version
+	cfg.Tracing.Environment = cfg.env
+	shutdownTracing, err := tracing.Setup(context.Background(), logger, cfg.Tracing)
 	if err != nil {
 		logger.PrintError(err, map[string]string{
-			"message": "failed ot init subs client",
+			"message": "failed to set up tracing",
 		})
 		os.Exit(1)
 	}
 
-	flag.Parse()
+	if toysHedgeDelay > 0 {
+		policy := cfg.Clients.Toys.Retry.Default
+		policy.HedgeDelay = toysHedgeDelay
+		cfg.Clients.Toys.Retry.Methods = map[string]retry.Policy{
+			toys.Toys_GetToy_FullMethodName: policy,
+		}
+	}
+	if cfg.Clients.RetryPolicyFile != "" {
+		if err := loadRetryPolicies(cfg.Clients.RetryPolicyFile, &cfg.Clients); err != nil {
+			logger.PrintError(err, map[string]string{
+				"message": "failed to load retry policies",
+			})
+			os.Exit(1)
+		}
+	}
+
+	subsCreds, err := newCredentials(cfg.Clients, cfg.Clients.Subs)
+	if err != nil {
+		logger.PrintError(err, map[string]string{
+			"message": "failed to init subs client credentials",
+		})
+		os.Exit(1)
+	}
+	toysCreds, err := newCredentials(cfg.Clients, cfg.Clients.Toys)
+	if err != nil {
+		logger.PrintError(err, map[string]string{
+			"message": "failed to init toys client credentials",
+		})
+		os.Exit(1)
+	}
+
+	subsTLS, err := newClientTLS(logger, cfg.Clients.Subs, cfg.GRPC.TLSReload)
+	if err != nil {
+		logger.PrintError(err, map[string]string{
+			"message": "failed to load subs client TLS certificates",
+		})
+		os.Exit(1)
+	}
+	toysTLS, err := newClientTLS(logger, cfg.Clients.Toys, cfg.GRPC.TLSReload)
+	if err != nil {
+		logger.PrintError(err, map[string]string{
+			"message": "failed to load toys client TLS certificates",
+		})
+		os.Exit(1)
+	}
+
+	subsClient, err := crtgrpc.New(context.Background(), logger, cfg.Clients.Subs.Conn, cfg.Clients.Subs.Retry, cfg.Clients.SubsCache, subsCreds, subsTLS, newBreaker(logger, "subscriptions", cfg.Clients.Subs.Breaker))
+	if err != nil {
+		logger.PrintError(err, map[string]string{
+			"message": "failed ot init subs client",
+		})
+		os.Exit(1)
+	}
+	toyClient, err := grpc.New(context.Background(), logger, cfg.Clients.Toys.Conn, cfg.Clients.Toys.Retry, cfg.Clients.ToysCache, toysCreds, toysTLS, newBreaker(logger, "toys", cfg.Clients.Toys.Breaker))
+	if err != nil {
+		logger.PrintError(err, map[string]string{
+			"message": "failed ot init toys client",
+		})
+		os.Exit(1)
+	}
 
 	app := New(logger, cfg.GRPC.Port, cfg, cfg.TokenTTL, subsClient, toyClient)
 
-	logger.PrintInfo("connection pool established", map[string]string{
-		"port": strconv.Itoa(cfg.GRPC.Port),
-	})
+	logger.Log(jsonlog.LevelInfo, "connection pool established", jsonlog.Int("port", cfg.GRPC.Port))
+	healthCtx, stopHealth := context.WithCancel(context.Background())
+	defer stopHealth()
+	go app.Health.Run(healthCtx)
+
 	go app.GRPCSrv.MustRun()
-	go runHttp(cfg.GRPC.Port, logger)
+	go runHttp(cfg, logger, app.Health, app.Verifier)
+	go runAdminHttp(cfg, logger)
 
 	stop := make(chan os.Signal, 1)
 	signal.Notify(stop, syscall.SIGTERM, syscall.SIGINT)
@@ -116,50 +442,425 @@ func main() {
 		"signal": sign.String(),
 	})
 
+	stopHealth()
 	app.GRPCSrv.Stop()
 
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancelFlush()
+	if err := shutdownTracing(flushCtx); err != nil {
+		logger.PrintError(err, map[string]string{
+			"message": "failed to flush traces",
+		})
+	}
+
+}
+
+// envDSN builds the default PostgreSQL DSN from the DB_* environment variables.
+func envDSN() string {
+	host := os.Getenv("DB_HOST")
+	port := os.Getenv("DB_PORT")
+	user := os.Getenv("DB_USER")
+	pass := os.Getenv("DB_PASSWORD")
+	name := os.Getenv("DB_NAME")
+
+	return fmt.Sprintf("postgres://%s:%s@%s:%s/%s?sslmode=disable&client_encoding=UTF8", user, pass, host, port, name)
+}
+
+// cartStorage is implemented by every storage backend selectable with -storage.
+type cartStorage interface {
+	AddToCart(ctx context.Context, toy data.CartItem, userID int64) (cart_v1_crt.OperationStatus, string)
+	DelFromCart(ctx context.Context, toyId int64, userID int64) (cart_v1_crt.OperationStatus, string)
+	ClearCart(ctx context.Context, userID int64) (cart_v1_crt.OperationStatus, string)
+	GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32)
+	Watch(ctx context.Context, userID int64) (<-chan struct{}, func())
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// newCredentials picks the credentials provider of a downstream client. Service tokens
+// and token exchange share one configuration; only the audience differs per client.
+func newCredentials(clients ClientsConfig, client Client) (credentials.Provider, error) {
+	switch client.Credentials {
+	case "forward", "":
+		return credentials.Forwarded{}, nil
+	case "service":
+		var key any
+		switch {
+		case clients.ServiceToken.KeyFile != "":
+			k, err := credentials.LoadPrivateKey(clients.ServiceToken.KeyFile)
+			if err != nil {
+				return nil, err
+			}
+			key = k
+		case clients.ServiceToken.Secret != "":
+			key = []byte(clients.ServiceToken.Secret)
+		default:
+			return nil, fmt.Errorf("service credentials need -service-token-key or -service-token-secret")
+		}
+		return credentials.NewServiceToken(credentials.ServiceTokenConfig{
+			Issuer:   clients.ServiceToken.Issuer,
+			Subject:  clients.ServiceToken.Subject,
+			Audience: client.Audience,
+			KeyID:    clients.ServiceToken.KeyID,
+			TTL:      clients.ServiceToken.TTL,
+		}, key)
+	case "exchange":
+		if clients.TokenExchange.URL == "" {
+			return nil, fmt.Errorf("exchange credentials need -token-exchange-url")
+		}
+		return credentials.NewExchange(credentials.ExchangeConfig{
+			Endpoint:     clients.TokenExchange.URL,
+			ClientID:     clients.TokenExchange.ClientID,
+			ClientSecret: clients.TokenExchange.ClientSecret,
+			Audience:     client.Audience,
+			Scope:        clients.TokenExchange.Scope,
+			Timeout:      clients.TokenExchange.Timeout,
+		}), nil
+	default:
+		return nil, fmt.Errorf("unknown client credentials %q", client.Credentials)
+	}
+}
+
+// newClientTLS returns nil for clients configured as insecure.
+func newClientTLS(log *jsonlog.Logger, client Client, reload time.Duration) (*tls.Config, error) {
+	if client.Insecure {
+		return nil, nil
+	}
+	reloader, err := tlsconfig.NewReloader(client.TLS)
+	if err != nil {
+		return nil, err
+	}
+	go reloader.Watch(context.Background(), log, reload)
+	return reloader.ClientConfig(), nil
+}
+
+// newBreaker returns nil, which disables the breaker, when cfg has no failure rate.
+func newBreaker(log *jsonlog.Logger, name string, cfg breaker.Config) *breaker.Breaker {
+	if !cfg.Enabled() {
+		return nil
+	}
+	return breaker.New(name, cfg, log)
+}
+
+// loadRetryPolicies reads per-method policies from path. Fields missing from a
+// method's policy are taken from the client's flag defaults.
+func loadRetryPolicies(path string, clients *ClientsConfig) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var file struct {
+		Subs struct {
+			Methods map[string]yaml.Node `yaml:"methods"`
+		} `yaml:"subs"`
+		Toys struct {
+			Methods map[string]yaml.Node `yaml:"methods"`
+		} `yaml:"toys"`
+	}
+	if err := yaml.Unmarshal(raw, &file); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+
+	for _, c := range []struct {
+		methods map[string]yaml.Node
+		cfg     *retry.Config
+	}{
+		{file.Subs.Methods, &clients.Subs.Retry},
+		{file.Toys.Methods, &clients.Toys.Retry},
+	} {
+		if c.cfg.Methods == nil {
+			c.cfg.Methods = make(map[string]retry.Policy)
+		}
+		for method, node := range c.methods {
+			policy, ok := c.cfg.Methods[method]
+			if !ok {
+				policy = c.cfg.Default
+			}
+			if err := node.Decode(&policy); err != nil {
+				return fmt.Errorf("%s: %s: %w", path, method, err)
+			}
+			c.cfg.Methods[method] = policy
+		}
+	}
+	return nil
+}
+
+// codesFlag parses a comma separated list of status code names into dst.
+func codesFlag(dst *[]string) func(string) error {
+	return func(v string) error {
+		*dst = nil
+		for _, code := range strings.Split(v, ",") {
+			if code = strings.TrimSpace(code); code != "" {
+				*dst = append(*dst, code)
+			}
+		}
+		return nil
+	}
+}
+
+// levelFlag parses a jsonlog level name into dst.
+func levelFlag(dst *jsonlog.Level) func(string) error {
+	return func(v string) error {
+		level, err := jsonlog.ParseLevel(v)
+		if err != nil {
+			return err
+		}
+		*dst = level
+		return nil
+	}
+}
+
+// sansFlag parses a comma separated SAN list into dst.
+func sansFlag(dst *[]string) func(string) error {
+	return func(v string) error {
+		*dst = nil
+		for _, san := range strings.Split(v, ",") {
+			if san = strings.TrimSpace(san); san != "" {
+				*dst = append(*dst, san)
+			}
+		}
+		return nil
+	}
+}
+
+func openStorage(log *jsonlog.Logger, cfg Config) (cartStorage, error) {
+	var storage cartStorage
+	switch cfg.Storage {
+	case "postgres":
+		db, err := postgres.OpenDB(log, postgres.StorageDetails(cfg.DB))
+		if err != nil {
+			return nil, err
+		}
+		prometheus.MustRegister(db.PoolCollector())
+		storage = db
+	case "memory":
+		storage = memory.New()
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", cfg.Storage)
+	}
+
+	var c cache.Cache
+	switch cfg.Cache.Backend {
+	case "none", "":
+		return storage, nil
+	case "lru":
+		c = cache.NewLRU(cfg.Cache.LRUSize)
+	case "redis":
+		c = cache.NewRedis(cache.RedisOptions{
+			Addr:     cfg.Cache.RedisAddr,
+			Password: cfg.Cache.RedisPassword,
+			DB:       cfg.Cache.RedisDB,
+		})
+	default:
+		storage.Close()
+		return nil, fmt.Errorf("unknown cache backend %q", cfg.Cache.Backend)
+	}
+
+	return cached.New(log, storage, c, cfg.Cache.TTL), nil
+}
+
+// newVerifier builds the JWT verifier from the -jwt-* flags and starts watching the
+// JWKS file, if any, for rotated keys.
+func newVerifier(log *jsonlog.Logger, cfg Config) (*auth.Verifier, error) {
+	var static []auth.Key
+	if cfg.AppSecret != "" {
+		static = append(static, auth.Key{Key: []byte(cfg.AppSecret)})
+	}
+	keys := auth.NewKeySet(static...)
+
+	if cfg.JWT.JWKSFile != "" {
+		if err := keys.LoadJWKSFile(cfg.JWT.JWKSFile); err != nil {
+			return nil, err
+		}
+		go keys.WatchJWKSFile(context.Background(), log, cfg.JWT.JWKSFile, cfg.JWT.JWKSReload)
+	}
+
+	if keys.Len() == 0 {
+		return nil, fmt.Errorf("no JWT verification keys configured, set -jwt-secret or -jwt-jwks-file")
+	}
+
+	return auth.NewVerifier(keys, auth.Config{
+		Algorithms: strings.Split(cfg.JWT.Algorithms, ","),
+		Issuer:     cfg.JWT.Issuer,
+		Audience:   cfg.JWT.Audience,
+		Leeway:     cfg.JWT.Leeway,
+	}), nil
+}
+
+func newLimiter(cfg Config) (*ratelimit.Limiter, error) {
+	limits, err := ratelimit.ParseLimits(cfg.RateLimit.Limits)
+	if err != nil {
+		return nil, err
+	}
+	if len(limits) == 0 {
+		return nil, nil
+	}
+
+	var store ratelimit.Store
+	switch cfg.RateLimit.Backend {
+	case "local":
+		store = ratelimit.NewLocalStore()
+	case "redis":
+		store = ratelimit.NewRedisStore(cache.NewRedis(cache.RedisOptions{
+			Addr:     cfg.Cache.RedisAddr,
+			Password: cfg.Cache.RedisPassword,
+			DB:       cfg.Cache.RedisDB,
+		}))
+	default:
+		return nil, fmt.Errorf("unknown rate limit backend %q", cfg.RateLimit.Backend)
+	}
+
+	return ratelimit.New(store, limits, cfg.RateLimit.FailOpen), nil
 }
 
 func New(log *jsonlog.Logger, grpcPort int, cfg Config, tokenTTL time.Duration, subsClient *crtgrpc.Client, toyClient *grpc.ToyClient) *Application {
-	dbCfg := postgres.StorageDetails(cfg.DB)
-	db, err := postgres.OpenDB(dbCfg)
+	verifier, err := newVerifier(log, cfg)
+	if err != nil {
+		log.PrintFatal(err, nil)
+	}
+
+	limiter, err := newLimiter(cfg)
+	if err != nil {
+		log.PrintFatal(err, nil)
+	}
+
+	db, err := openStorage(log, cfg)
 	if err != nil {
 		log.PrintFatal(err, nil)
 	}
 
 	//defer db.Close()
 
-	orderService := cart.New(log, db, tokenTTL, subsClient, toyClient)
-	grpcApp := grpcapp.New(log, grpcPort, orderService)
+	auditOut := io.Writer(os.Stdout)
+	if cfg.AuditLog != "" {
+		f, err := os.OpenFile(cfg.AuditLog, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o640)
+		if err != nil {
+			log.PrintFatal(err, nil)
+		}
+		auditOut = f
+	}
+
+	subsPolicy := cart.DefaultSubsPolicy()
+	subsPolicy.Grace = cfg.SubsPolicyGrace
+	if err := subsPolicy.ParseModes(cfg.SubsPolicy); err != nil {
+		log.PrintFatal(err, nil)
+	}
+
+	orderService := cart.New(log, db, tokenTTL, subsPolicy, subsClient, toyClient)
+	adminService := admin.New(log, db, toyClient, audit.New(auditOut))
+	var serverTLS *tls.Config
+	if cfg.GRPC.TLS.Enabled() {
+		reloader, err := tlsconfig.NewReloader(cfg.GRPC.TLS)
+		if err != nil {
+			log.PrintFatal(err, nil)
+		}
+		go reloader.Watch(context.Background(), log, cfg.GRPC.TLSReload)
+		serverTLS = reloader.ServerConfig()
+	}
+
+	grpcApp := grpcapp.New(log, grpcPort, orderService, adminService, verifier, limiter, serverTLS)
+
+	required := make(map[string]bool)
+	for _, name := range strings.Split(cfg.Health.Required, ",") {
+		required[strings.TrimSpace(name)] = true
+	}
+	monitor := health.NewMonitor(log, grpcApp.Health, []string{"", "cart.Cart"}, cfg.Health.Interval, cfg.Health.Timeout,
+		health.Check{Name: "storage", Func: db.Ping, Optional: !required["storage"]},
+		health.Check{Name: "subscriptions", Func: subsClient.Health, Optional: !required["subscriptions"]},
+		health.Check{Name: "toys", Func: toyClient.Health, Optional: !required["toys"]},
+	)
 
-	return &Application{GRPCSrv: grpcApp}
+	return &Application{GRPCSrv: grpcApp, Health: monitor, Verifier: verifier}
 }
 
-func runHttp(grpcPort int, logger *jsonlog.Logger) {
+func runHttp(cfg Config, logger *jsonlog.Logger, monitor *health.Monitor, verifier *auth.Verifier) {
 	ctx := context.Background()
-	mux := runtime.NewServeMux()
+	// X-Request-Id is handed to the gRPC server and its answer returned to the client;
+	// other headers keep the gateway defaults.
+	mux := runtime.NewServeMux(
+		runtime.WithIncomingHeaderMatcher(func(key string) (string, bool) {
+			if strings.EqualFold(key, grpcapp.RequestIDHeader) {
+				return grpcapp.RequestIDHeader, true
+			}
+			return runtime.DefaultHeaderMatcher(key)
+		}),
+		runtime.WithOutgoingHeaderMatcher(func(key string) (string, bool) {
+			if key == grpcapp.RequestIDHeader {
+				return "X-Request-Id", true
+			}
+			return runtime.MetadataHeaderPrefix + key, true
+		}),
+	)
+
+	transport := insecure.NewCredentials()
+	if cfg.GRPC.TLS.Enabled() {
+		gatewayTLS := cfg.GRPC.GatewayTLS
+		if gatewayTLS.CertFile == "" {
+			gatewayTLS.CertFile, gatewayTLS.KeyFile = cfg.GRPC.TLS.CertFile, cfg.GRPC.TLS.KeyFile
+		}
+		if gatewayTLS.CAFile == "" {
+			gatewayTLS.CAFile = cfg.GRPC.TLS.CAFile
+		}
+		reloader, err := tlsconfig.NewReloader(gatewayTLS)
+		if err != nil {
+			logger.PrintFatal(err, map[string]string{
+				"message": "failed to load HTTP gateway TLS certificates",
+				"method":  "main.runHTTP",
+			})
+		}
+		go reloader.Watch(ctx, logger, cfg.GRPC.TLSReload)
+		transport = grpccreds.NewTLS(reloader.ClientConfig())
+	}
 	opts := []grpc2.DialOption{
-		grpc2.WithTransportCredentials(insecure.NewCredentials()),
+		grpc2.WithTransportCredentials(transport),
+		grpc2.WithStatsHandler(tracing.ClientHandler()),
 	}
 
-	endpoint := "localhost:" + strconv.Itoa(grpcPort)
+	endpoint := "localhost:" + strconv.Itoa(cfg.GRPC.Port)
 	if err := cart_v1_crt.RegisterCartHandlerFromEndpoint(ctx, mux, endpoint, opts); err != nil {
 		logger.PrintFatal(err, map[string]string{
 			"message": "failed to start HTTP gateway",
 			"method":  "main.runHTTP",
 		})
 	}
+	// The public listener gets its own mux: anything registered on
+	// http.DefaultServeMux, such as expvar's /debug/vars, stays off it.
+	public := http.NewServeMux()
 	fs := http.FileServer(http.Dir("C:\\Users\\Еркебулан\\GolandProjects\\protoCart\\proto\\gen\\swagger"))
-	http.Handle("/swagger/", http.StripPrefix("/swagger/", fs))
-	http.Handle("/", mux)
+	public.Handle("/swagger/", http.StripPrefix("/swagger/", fs))
+	public.HandleFunc("/healthz", health.Healthz)
+	public.HandleFunc("/readyz", monitor.Readyz)
+	public.Handle("/admin/log-level", auth.RequireRole(verifier, admingrpc.AdminRole, logger.LevelHandler()))
+	// The gateway continues the trace of incoming traceparent headers and hands it
+	// on to the gRPC server.
+	public.Handle("/", otelhttp.NewHandler(mux, "gateway"))
 
 	logger.PrintInfo("HTTP REST gateway and Swagger docs started", map[string]string{
 		"port": "8080",
 	})
 
-	if err := http.ListenAndServe(":8080", mux); err != nil {
+	if err := http.ListenAndServe(":8080", public); err != nil {
 		logger.PrintFatal(err, map[string]string{
 			"message": "HTTP gateway crashed",
 		})
 	}
 }
+
+// runAdminHttp serves the operator endpoints: Prometheus metrics and expvar (cache
+// and breaker stats).
+func runAdminHttp(cfg Config, logger *jsonlog.Logger) {
+	admin := http.NewServeMux()
+	admin.Handle("/metrics", promhttp.Handler())
+	admin.Handle("/debug/vars", expvar.Handler())
+
+	logger.PrintInfo("admin HTTP listener started", map[string]string{
+		"addr": cfg.AdminAddr,
+	})
+
+	if err := http.ListenAndServe(cfg.AdminAddr, admin); err != nil {
+		logger.PrintFatal(err, map[string]string{
+			"message": "admin HTTP listener crashed",
+		})
+	}
+}
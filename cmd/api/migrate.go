@@ -0,0 +1,124 @@
+package main
+
+import (
+	"cartService/internal/jsonlog"
+	"cartService/migrations"
+	"cartService/storage/postgres"
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"time"
+)
+
+const migrateUsage = `usage: api migrate [flags] <up|down|status|version|force <version>>
+
+  up       apply all pending migrations
+  down     roll back the last -steps migrations
+  status   list migrations and whether they are applied
+  version  print the current schema version
+  force    record <version> as the current, clean schema version without running
+           any script, after a failed migration was fixed by hand
+`
+
+// runMigrate implements the "migrate" subcommand and returns the process exit code.
+func runMigrate(args []string) int {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprint(fs.Output(), migrateUsage)
+		fs.PrintDefaults()
+	}
+
+	var dsn string
+	var steps int
+	var timeout time.Duration
+	fs.StringVar(&dsn, "db-dsn", envDSN(), "PostgresSQL DSN")
+	fs.IntVar(&steps, "steps", 1, "Number of migrations to roll back with down")
+	fs.DurationVar(&timeout, "timeout", 5*time.Minute, "Maximum time to wait for the migration lock and scripts")
+
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if fs.NArg() != 1 && !(fs.NArg() == 2 && fs.Arg(0) == "force") {
+		fs.Usage()
+		return 2
+	}
+
+	db, err := postgres.OpenDB(jsonlog.New(os.Stderr, jsonlog.LevelInfo), postgres.StorageDetails{
+		DSN:          dsn,
+		MaxOpenConns: 2,
+		MaxIdleConns: 1,
+		MaxIdleTime:  "1m",
+	})
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+	defer db.Close()
+
+	migrator, err := postgres.NewMigrator(db, migrations.FS)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "migrate:", err)
+		return 1
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	switch fs.Arg(0) {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		fmt.Printf("applied %d migrations\n", applied)
+	case "down":
+		reverted, err := migrator.Down(ctx, steps)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		fmt.Printf("rolled back %d migrations\n", reverted)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		for _, st := range statuses {
+			state := "pending"
+			if st.Applied {
+				state = "applied"
+			}
+			fmt.Printf("%06d %-40s %s\n", st.Version, st.Name, state)
+		}
+	case "version":
+		version, dirty, err := migrator.Version(ctx)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		if dirty {
+			fmt.Printf("%d (dirty)\n", version)
+		} else {
+			fmt.Println(version)
+		}
+	case "force":
+		version, err := strconv.ParseInt(fs.Arg(1), 10, 64)
+		if err != nil || version < 0 {
+			fmt.Fprintf(os.Stderr, "migrate: invalid version %q\n", fs.Arg(1))
+			return 2
+		}
+		if err := migrator.Force(ctx, version); err != nil {
+			fmt.Fprintln(os.Stderr, "migrate:", err)
+			return 1
+		}
+		fmt.Printf("forced version %d\n", version)
+	default:
+		fs.Usage()
+		return 2
+	}
+	return 0
+}
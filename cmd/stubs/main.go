@@ -0,0 +1,110 @@
+// Command stubs serves the subscriptions and toys services from a fixture so the cart
+// service can run locally without them. Send SIGHUP to reload the fixture.
+package main
+
+import (
+	"cartService/internal/jsonlog"
+	"cartService/internal/stubs"
+	"flag"
+	"fmt"
+	"net"
+	"os"
+	"os/signal"
+	"syscall"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+)
+
+func main() {
+	var fixturePath string
+	var subsPort, toysPort int
+
+	flag.StringVar(&fixturePath, "fixture", "", "YAML or JSON fixture with users, toys and faults (default: every user subscribed, no toys)")
+	flag.IntVar(&subsPort, "subs-port", 3000, "Port of the subscriptions stub")
+	flag.IntVar(&toysPort, "toys-port", 9000, "Port of the toys stub")
+	flag.Parse()
+
+	logger := jsonlog.New(os.Stdout, jsonlog.LevelInfo)
+
+	fixture, err := loadFixture(fixturePath)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+	s, err := stubs.New(logger, fixture)
+	if err != nil {
+		logger.PrintFatal(err, nil)
+	}
+
+	subsSrv := newServer()
+	s.RegisterSubscriptions(subsSrv)
+	toysSrv := newServer()
+	s.RegisterToys(toysSrv)
+
+	for _, srv := range []struct {
+		name   string
+		port   int
+		server *grpc.Server
+	}{
+		{"subscriptions", subsPort, subsSrv},
+		{"toys", toysPort, toysSrv},
+	} {
+		l, err := net.Listen("tcp", fmt.Sprintf(":%d", srv.port))
+		if err != nil {
+			logger.PrintFatal(err, map[string]string{
+				"service": srv.name,
+			})
+		}
+		logger.Log(jsonlog.LevelInfo, "stub is running",
+			jsonlog.String("service", srv.name),
+			jsonlog.Int("port", srv.port),
+		)
+		go srv.server.Serve(l)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+	for sign := range signals {
+		if sign != syscall.SIGHUP {
+			logger.PrintInfo("stopping stubs", map[string]string{
+				"signal": sign.String(),
+			})
+			break
+		}
+
+		fixture, err := loadFixture(fixturePath)
+		if err == nil {
+			err = s.SetFixture(fixture)
+		}
+		if err != nil {
+			logger.PrintError(err, map[string]string{
+				"message": "fixture not reloaded",
+			})
+			continue
+		}
+		logger.PrintInfo("fixture reloaded", map[string]string{
+			"fixture": fixturePath,
+		})
+	}
+
+	subsSrv.GracefulStop()
+	toysSrv.GracefulStop()
+}
+
+func newServer() *grpc.Server {
+	srv := grpc.NewServer()
+	healthpb.RegisterHealthServer(srv, health.NewServer())
+	reflection.Register(srv)
+	return srv
+}
+
+func loadFixture(path string) (*stubs.Fixture, error) {
+	if path == "" {
+		return &stubs.Fixture{
+			Subscriptions: stubs.Subscriptions{Default: "subscribed"},
+		}, nil
+	}
+	return stubs.LoadFixture(path)
+}
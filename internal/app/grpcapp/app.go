@@ -1,14 +1,20 @@
 package grpcapp
 
 import (
-	"cartService/internal/contextkeys"
+	"cartService/internal/auth"
+	admingrpc "cartService/internal/grpc/admin"
 	crtgrpc "cartService/internal/grpc/cart"
 	"cartService/internal/jsonlog"
+	"cartService/internal/ratelimit"
+	"cartService/internal/tracing"
 	"context"
+	"crypto/tls"
 	"fmt"
-	"github.com/golang-jwt/jwt/v5"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"net"
@@ -18,69 +24,124 @@ import (
 type App struct {
 	Log        *jsonlog.Logger
 	GRPCServer *grpc.Server
-	Port       int
+	// Health is the grpc.health.v1 service; its status is driven by health.Monitor.
+	Health *health.Server
+	Port   int
 }
 
-func UnaryJWTInterceptor(secret []byte) grpc.UnaryServerInterceptor {
+func UnaryJWTInterceptor(verifier *auth.Verifier) grpc.UnaryServerInterceptor {
 	return func(
 		ctx context.Context,
 		req interface{},
 		info *grpc.UnaryServerInfo,
 		handler grpc.UnaryHandler) (interface{}, error) {
 
-		md, ok := metadata.FromIncomingContext(ctx)
-		if !ok {
-			return nil, status.Error(codes.Unauthenticated, "missing metadata")
+		if isPublic(info.FullMethod) {
+			return handler(ctx, req)
 		}
-
-		authHeader := md["authorization"]
-		if len(authHeader) == 0 || !strings.HasPrefix(authHeader[0], "Bearer ") {
-			return nil, status.Error(codes.Unauthenticated, "missing or invalid authorization header")
+		ctx, err := authenticate(ctx, verifier)
+		if err != nil {
+			return nil, err
 		}
+		return handler(ctx, req)
+	}
+}
 
-		tokenStr := strings.TrimPrefix(authHeader[0], "Bearer ")
-		token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return secret, nil
-		})
+func StreamJWTInterceptor(verifier *auth.Verifier) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
 
-		if err != nil || !token.Valid {
-			return nil, status.Error(codes.Unauthenticated, "invalid token")
+		if isPublic(info.FullMethod) {
+			return handler(srv, ss)
 		}
-
-		claims, ok := token.Claims.(jwt.MapClaims)
-		if !ok {
-			return nil, status.Error(codes.Internal, "cannot parse claims")
+		ctx, err := authenticate(ss.Context(), verifier)
+		if err != nil {
+			return err
 		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
 
-		userIDFloat, ok := claims["user_id"].(float64)
-		if !ok {
-			return nil, status.Error(codes.Internal, "user ID not found or invalid type in token")
-		}
+// isPublic reports whether method may be called without a token. Health checks come
+// from load balancers and orchestrators that have none.
+func isPublic(method string) bool {
+	return strings.HasPrefix(method, "/grpc.health.v1.Health/")
+}
 
-		// Convert to int64
-		userID := int64(userIDFloat)
-		if err != nil {
-			return nil, status.Error(codes.Internal, "invalid user ID format")
-		}
+// serverStream overrides the context of a stream so handlers see the claims added
+// by the stream interceptors.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
 
-		ctx = context.WithValue(ctx, contextkeys.UserIDKey, userID)
-		return handler(ctx, req)
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
+
+// authenticate verifies the bearer token in the incoming metadata and returns ctx
+// carrying its claims.
+func authenticate(ctx context.Context, verifier *auth.Verifier) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Error(codes.Unauthenticated, "missing metadata")
+	}
+
+	authHeader := md["authorization"]
+	if len(authHeader) == 0 || !strings.HasPrefix(authHeader[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "missing or invalid authorization header")
+	}
 
+	tokenStr := strings.TrimPrefix(authHeader[0], "Bearer ")
+	claims, err := verifier.Verify(tokenStr)
+	if err != nil {
+		return nil, status.Error(codes.Unauthenticated, "invalid token")
 	}
+
+	return auth.ContextWithClaims(ctx, claims), nil
 }
 
-func New(log *jsonlog.Logger, port int, cartService crtgrpc.Carts) *App {
-	gRPCServer := grpc.NewServer(
-		grpc.UnaryInterceptor(UnaryJWTInterceptor([]byte("test-secret"))),
-	)
+// New builds the gRPC server. limiter may be nil to disable rate limiting and tlsCfg
+// nil to serve plaintext.
+func New(log *jsonlog.Logger, port int, cartService crtgrpc.Carts, adminService admingrpc.Admin, verifier *auth.Verifier, limiter *ratelimit.Limiter, tlsCfg *tls.Config) *App {
+	unary := []grpc.UnaryServerInterceptor{
+		UnaryMetricsInterceptor(),
+		UnaryRequestIDInterceptor(),
+		UnaryJWTInterceptor(verifier),
+	}
+	stream := []grpc.StreamServerInterceptor{
+		StreamMetricsInterceptor(),
+		StreamRequestIDInterceptor(),
+		StreamJWTInterceptor(verifier),
+	}
+	if limiter != nil {
+		unary = append(unary, UnaryRateLimitInterceptor(log, limiter))
+		stream = append(stream, StreamRateLimitInterceptor(log, limiter))
+	}
+
+	opts := []grpc.ServerOption{
+		grpc.StatsHandler(tracing.ServerHandler()),
+		grpc.ChainUnaryInterceptor(unary...),
+		grpc.ChainStreamInterceptor(stream...),
+	}
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+
+	gRPCServer := grpc.NewServer(opts...)
 	crtgrpc.Register(gRPCServer, cartService)
+	admingrpc.Register(gRPCServer, adminService)
+
+	healthServer := health.NewServer()
+	healthpb.RegisterHealthServer(gRPCServer, healthServer)
 
 	return &App{
 		Log:        log,
 		GRPCServer: gRPCServer,
+		Health:     healthServer,
 		Port:       port,
 	}
 }
@@ -105,5 +166,7 @@ func (a *App) Run() error {
 }
 
 func (a *App) Stop() {
+	// Tell health checking clients to move away before connections are drained.
+	a.Health.Shutdown()
 	a.GRPCServer.GracefulStop()
 }
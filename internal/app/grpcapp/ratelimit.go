@@ -0,0 +1,84 @@
+package grpcapp
+
+import (
+	"cartService/internal/contextkeys"
+	"cartService/internal/jsonlog"
+	"cartService/internal/ratelimit"
+	"context"
+	"math"
+	"strconv"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// RetryAfterHeader carries the number of seconds to wait before retrying a call
+// rejected with codes.ResourceExhausted.
+const RetryAfterHeader = "retry-after"
+
+// UnaryRateLimitInterceptor must run after the JWT interceptor so calls are limited
+// per user rather than per connection.
+func UnaryRateLimitInterceptor(log *jsonlog.Logger, limiter *ratelimit.Limiter) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		if err := checkRateLimit(ctx, log, limiter, info.FullMethod); err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+func StreamRateLimitInterceptor(log *jsonlog.Logger, limiter *ratelimit.Limiter) grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+
+		if err := checkRateLimit(ss.Context(), log, limiter, info.FullMethod); err != nil {
+			return err
+		}
+		return handler(srv, ss)
+	}
+}
+
+func checkRateLimit(ctx context.Context, log *jsonlog.Logger, limiter *ratelimit.Limiter, method string) error {
+	subject := rateLimitSubject(ctx)
+
+	allowed, retryAfter, err := limiter.Allow(ctx, method, subject)
+	if err != nil {
+		log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "grpcapp.checkRateLimit",
+			"rpc":    method,
+		})
+		// The limiter fails closed: the caller is not over its limit, so there is no
+		// retry-after to give.
+		if !allowed {
+			return status.Error(codes.Unavailable, "rate limiter unavailable")
+		}
+	}
+	if allowed {
+		return nil
+	}
+
+	seconds := strconv.Itoa(int(math.Ceil(retryAfter.Seconds())))
+	grpc.SetHeader(ctx, metadata.Pairs(RetryAfterHeader, seconds))
+	return status.Errorf(codes.ResourceExhausted, "rate limit exceeded, retry after %ss", seconds)
+}
+
+func rateLimitSubject(ctx context.Context) string {
+	if userID, ok := ctx.Value(contextkeys.UserIDKey).(int64); ok {
+		return "user:" + strconv.FormatInt(userID, 10)
+	}
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		return "peer:" + p.Addr.String()
+	}
+	return "anonymous"
+}
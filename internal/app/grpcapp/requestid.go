@@ -0,0 +1,69 @@
+package grpcapp
+
+import (
+	"cartService/internal/clients/requestid"
+	"cartService/internal/contextkeys"
+	"context"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// RequestIDHeader identifies a call across this service, the HTTP gateway and the
+// downstream services. It is echoed in the response headers.
+const RequestIDHeader = requestid.Header
+
+// UnaryRequestIDInterceptor must run before the interceptors that log, so their
+// entries carry the id too.
+func UnaryRequestIDInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req interface{},
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler) (interface{}, error) {
+
+		return handler(withRequestID(ctx), req)
+	}
+}
+
+func StreamRequestIDInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv interface{},
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler) error {
+
+		return handler(srv, &serverStream{ServerStream: ss, ctx: withRequestID(ss.Context())})
+	}
+}
+
+// withRequestID keeps the caller's request id when it has a usable one and assigns a
+// new one otherwise.
+func withRequestID(ctx context.Context) context.Context {
+	md, _ := metadata.FromIncomingContext(ctx)
+	var id string
+	if values := md.Get(RequestIDHeader); len(values) > 0 && validRequestID(values[0]) {
+		id = values[0]
+	} else {
+		id = uuid.NewString()
+	}
+
+	// SetHeader only fails once headers were sent, which can't have happened yet.
+	_ = grpc.SetHeader(ctx, metadata.Pairs(RequestIDHeader, id))
+	return context.WithValue(ctx, contextkeys.RequestIDKey, id)
+}
+
+// validRequestID accepts up to 128 printable ASCII characters without spaces, so a
+// caller can't inject anything odd into the logs.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
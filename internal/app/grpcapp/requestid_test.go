@@ -0,0 +1,74 @@
+package grpcapp
+
+import (
+	"cartService/internal/contextkeys"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/google/uuid"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// headerStream records the headers a handler sets.
+type headerStream struct {
+	grpc.ServerTransportStream
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string { return "/cart.Cart/GetCart" }
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func TestUnaryRequestIDInterceptor(t *testing.T) {
+	tests := []struct {
+		name   string
+		id     []string
+		keepID bool
+	}{
+		{"valid id", []string{"req-1.a_b~C"}, true},
+		{"no id", nil, false},
+		{"empty id", []string{""}, false},
+		{"oversized id", []string{strings.Repeat("a", 129)}, false},
+		{"id of the maximum length", []string{strings.Repeat("a", 128)}, true},
+		{"id with a space", []string{"req 1"}, false},
+		{"id with a newline", []string{"req-1\n{\"level\":\"ERROR\"}"}, false},
+		{"non-ASCII id", []string{"req-é"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			md := metadata.MD{}
+			if tt.id != nil {
+				md[RequestIDHeader] = tt.id
+			}
+			stream := &headerStream{}
+			ctx := grpc.NewContextWithServerTransportStream(metadata.NewIncomingContext(context.Background(), md), stream)
+
+			var seen string
+			handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+				seen, _ = ctx.Value(contextkeys.RequestIDKey).(string)
+				return nil, nil
+			}
+			if _, err := UnaryRequestIDInterceptor()(ctx, nil, &grpc.UnaryServerInfo{}, handler); err != nil {
+				t.Fatalf("interceptor: %v", err)
+			}
+
+			if got := stream.header.Get(RequestIDHeader); len(got) != 1 || got[0] != seen {
+				t.Fatalf("response header %q, want the id %q the handler saw", got, seen)
+			}
+			if tt.keepID {
+				if seen != tt.id[0] {
+					t.Fatalf("request id %q, want the caller's %q", seen, tt.id[0])
+				}
+				return
+			}
+			if _, err := uuid.Parse(seen); err != nil {
+				t.Fatalf("request id %q, want a generated UUID", seen)
+			}
+		})
+	}
+}
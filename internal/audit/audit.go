@@ -0,0 +1,60 @@
+package audit
+
+import (
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+)
+
+// Entry is one audited action. Every field is written, even when empty, so the log
+// can be loaded into a table without schema guessing.
+type Entry struct {
+	// Type is always "audit", so entries sharing an output with the application
+	// log can be told apart from it.
+	Type       string            `json:"type"`
+	Time       string            `json:"time"`
+	Actor      int64             `json:"actor"`
+	Action     string            `json:"action"`
+	TargetUser int64             `json:"target_user"`
+	Status     string            `json:"status"`
+	Details    map[string]string `json:"details"`
+}
+
+// Logger appends audit entries as JSON lines to out. It is kept apart from the
+// application log so it can be shipped and retained separately.
+type Logger struct {
+	out io.Writer
+	mu  sync.Mutex
+}
+
+// entryType tags every audit entry.
+const entryType = "audit"
+
+func New(out io.Writer) *Logger {
+	return &Logger{out: out}
+}
+
+func (l *Logger) Record(actor int64, action string, targetUser int64, status string, details map[string]string) error {
+	if details == nil {
+		details = map[string]string{}
+	}
+
+	line, err := json.Marshal(Entry{
+		Type:       entryType,
+		Time:       time.Now().UTC().Format(time.RFC3339Nano),
+		Actor:      actor,
+		Action:     action,
+		TargetUser: targetUser,
+		Status:     status,
+		Details:    details,
+	})
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	_, err = l.out.Write(append(line, '\n'))
+	return err
+}
@@ -0,0 +1,137 @@
+package auth
+
+import (
+	"cartService/internal/contextkeys"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidUserID = errors.New("auth: user id missing or invalid")
+
+// Claims are the application claims of a verified token.
+type Claims struct {
+	UserID int64
+	Roles  []string
+	Plan   string
+	Tenant string
+	// ExpiresAt is the "exp" of the token, required by the Verifier.
+	ExpiresAt time.Time
+}
+
+// claimsFromMap extracts Claims from verified raw claims. The user id is read from
+// "user_id" and falls back to "sub"; both may be a JSON number or a numeric string.
+// The map must have been decoded with json.Number so large ids keep their precision.
+func claimsFromMap(m jwt.MapClaims) (*Claims, error) {
+	raw, ok := m["user_id"]
+	if !ok {
+		raw, ok = m["sub"]
+	}
+	if !ok {
+		return nil, ErrInvalidUserID
+	}
+
+	userID, err := parseUserID(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	claims := &Claims{
+		UserID: userID,
+		Roles:  parseRoles(m),
+		Plan:   stringClaim(m, "plan"),
+		Tenant: firstNonEmpty(stringClaim(m, "tenant"), stringClaim(m, "tenant_id")),
+	}
+	if exp, err := m.GetExpirationTime(); err == nil && exp != nil {
+		claims.ExpiresAt = exp.Time
+	}
+	return claims, nil
+}
+
+func parseUserID(raw any) (int64, error) {
+	var s string
+	switch v := raw.(type) {
+	case json.Number:
+		s = v.String()
+	case string:
+		s = v
+	default:
+		return 0, fmt.Errorf("%w: unsupported type %T", ErrInvalidUserID, raw)
+	}
+
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("%w: %q", ErrInvalidUserID, s)
+	}
+	return id, nil
+}
+
+// parseRoles accepts "roles" as a JSON array or a space/comma separated string, and a
+// single "role" string.
+func parseRoles(m jwt.MapClaims) []string {
+	var roles []string
+	switch v := m["roles"].(type) {
+	case []any:
+		for _, r := range v {
+			if s, ok := r.(string); ok && s != "" {
+				roles = append(roles, s)
+			}
+		}
+	case string:
+		roles = strings.FieldsFunc(v, func(r rune) bool {
+			return r == ' ' || r == ','
+		})
+	}
+	if role := stringClaim(m, "role"); role != "" && !slices.Contains(roles, role) {
+		roles = append(roles, role)
+	}
+	return roles
+}
+
+func stringClaim(m jwt.MapClaims, name string) string {
+	switch v := m[name].(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	default:
+		return ""
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ContextWithClaims stores the claims under the contextkeys used by the services.
+func ContextWithClaims(ctx context.Context, c *Claims) context.Context {
+	ctx = context.WithValue(ctx, contextkeys.UserIDKey, c.UserID)
+	ctx = context.WithValue(ctx, contextkeys.RolesKey, c.Roles)
+	ctx = context.WithValue(ctx, contextkeys.PlanKey, c.Plan)
+	ctx = context.WithValue(ctx, contextkeys.TenantKey, c.Tenant)
+	if !c.ExpiresAt.IsZero() {
+		ctx = context.WithValue(ctx, contextkeys.ExpiresAtKey, c.ExpiresAt)
+	}
+	return ctx
+}
+
+func RolesFromContext(ctx context.Context) []string {
+	roles, _ := ctx.Value(contextkeys.RolesKey).([]string)
+	return roles
+}
+
+func HasRole(ctx context.Context, role string) bool {
+	return slices.Contains(RolesFromContext(ctx), role)
+}
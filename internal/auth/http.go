@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RequireRole serves next only to requests whose bearer token verifies and carries
+// role; the claims are in the request context as for gRPC calls.
+func RequireRole(verifier *Verifier, role string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		if !strings.HasPrefix(header, "Bearer ") {
+			http.Error(w, "missing or invalid authorization header", http.StatusUnauthorized)
+			return
+		}
+		claims, err := verifier.Verify(strings.TrimPrefix(header, "Bearer "))
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := ContextWithClaims(r.Context(), claims)
+		if !HasRole(ctx, role) {
+			http.Error(w, "role "+role+" required", http.StatusForbidden)
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"cartService/internal/jsonlog"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"os"
+	"time"
+)
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// Symmetric
+	K string `json:"k"`
+}
+
+// ParseJWKS decodes a JSON Web Key Set (RFC 7517). Keys whose "use" is not "sig" are
+// skipped; RSA, EC (P-256/384/521) and symmetric "oct" keys are supported.
+func ParseJWKS(raw []byte) ([]Key, error) {
+	var set jwks
+	if err := json.Unmarshal(raw, &set); err != nil {
+		return nil, fmt.Errorf("%s: %w", "auth.ParseJWKS", err)
+	}
+
+	keys := make([]Key, 0, len(set.Keys))
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("auth.ParseJWKS: key %d (kid %q): %w", i, k.Kid, err)
+		}
+		keys = append(keys, Key{
+			ID:        k.Kid,
+			Algorithm: k.Alg,
+			Key:       key,
+		})
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (any, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("exponent: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("exponent out of range")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("x: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("y: %w", err)
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	case "oct":
+		secret, err := base64.RawURLEncoding.DecodeString(k.K)
+		if err != nil {
+			return nil, fmt.Errorf("secret: %w", err)
+		}
+		return secret, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// LoadJWKSFile replaces the file keys of the set with the keys in path.
+func (ks *KeySet) LoadJWKSFile(path string) error {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("%s: %w", "auth.LoadJWKSFile", err)
+	}
+	keys, err := ParseJWKS(raw)
+	if err != nil {
+		return err
+	}
+	ks.setFileKeys(keys)
+	return nil
+}
+
+// WatchJWKSFile reloads path whenever its modification time or size changes, checking
+// every interval until ctx is done. A file that fails to load keeps the previous keys
+// active so a half-written rotation can't lock every user out.
+func (ks *KeySet) WatchJWKSFile(ctx context.Context, log *jsonlog.Logger, path string, interval time.Duration) {
+	var lastMod time.Time
+	var lastSize int64
+	if fi, err := os.Stat(path); err == nil {
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		fi, err := os.Stat(path)
+		if err != nil {
+			log.PrintError(err, map[string]string{
+				"method": "auth.WatchJWKSFile",
+			})
+			continue
+		}
+		if fi.ModTime().Equal(lastMod) && fi.Size() == lastSize {
+			continue
+		}
+
+		if err := ks.LoadJWKSFile(path); err != nil {
+			log.PrintError(err, map[string]string{
+				"method": "auth.WatchJWKSFile",
+			})
+			continue
+		}
+		lastMod, lastSize = fi.ModTime(), fi.Size()
+		log.Log(jsonlog.LevelInfo, "reloaded JWKS file",
+			jsonlog.String("path", path),
+			jsonlog.Int("keys", ks.Len()),
+		)
+	}
+}
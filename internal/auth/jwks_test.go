@@ -0,0 +1,196 @@
+package auth
+
+import (
+	"bytes"
+	"cartService/internal/jsonlog"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func b64(n *big.Int) string {
+	return base64.RawURLEncoding.EncodeToString(n.Bytes())
+}
+
+func rsaJWK(kid string, key *rsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "RSA", "kid": kid, "use": "sig", "alg": "RS256", "n": b64(key.N), "e": b64(big.NewInt(int64(key.E)))}
+}
+
+func ecJWK(kid string, key *ecdsa.PublicKey) map[string]string {
+	return map[string]string{"kty": "EC", "kid": kid, "crv": "P-256", "x": b64(key.X), "y": b64(key.Y)}
+}
+
+func jwksJSON(t *testing.T, keys ...map[string]string) []byte {
+	t.Helper()
+	raw, err := json.Marshal(map[string]any{"keys": keys})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestParseJWKS(t *testing.T) {
+	rsaPriv := rsaKey(t)
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encryption := rsaJWK("enc", &rsaKey(t).PublicKey)
+	encryption["use"] = "enc"
+
+	keys, err := ParseJWKS(jwksJSON(t,
+		rsaJWK("rsa", &rsaPriv.PublicKey),
+		encryption,
+		ecJWK("ec", &ecPriv.PublicKey),
+	))
+	if err != nil {
+		t.Fatalf("ParseJWKS: %v", err)
+	}
+	if len(keys) != 2 {
+		t.Fatalf("got %d keys, want the RSA and EC signing keys: %+v", len(keys), keys)
+	}
+
+	if keys[0].ID != "rsa" || keys[0].Algorithm != "RS256" {
+		t.Errorf("RSA key = %+v", keys[0])
+	}
+	if pub, ok := keys[0].Key.(*rsa.PublicKey); !ok || !pub.Equal(&rsaPriv.PublicKey) {
+		t.Errorf("RSA key = %v, want the generated public key", keys[0].Key)
+	}
+	if keys[1].ID != "ec" || keys[1].Algorithm != "" {
+		t.Errorf("EC key = %+v", keys[1])
+	}
+	if pub, ok := keys[1].Key.(*ecdsa.PublicKey); !ok || !pub.Equal(&ecPriv.PublicKey) {
+		t.Errorf("EC key = %v, want the generated public key", keys[1].Key)
+	}
+
+	ks := NewKeySet()
+	ks.setFileKeys(keys)
+	if err := parse(ks, sign(t, jwt.SigningMethodRS256, rsaPriv, "rsa")); err != nil {
+		t.Errorf("RS256 token: %v", err)
+	}
+	if err := parse(ks, sign(t, jwt.SigningMethodES256, ecPriv, "ec")); err != nil {
+		t.Errorf("ES256 token: %v", err)
+	}
+}
+
+func TestParseJWKSErrors(t *testing.T) {
+	ecPriv, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	offCurve := ecJWK("ec", &ecPriv.PublicKey)
+	offCurve["y"] = b64(new(big.Int).Add(ecPriv.Y, big.NewInt(1)))
+	otherCurve := ecJWK("ec", &ecPriv.PublicKey)
+	otherCurve["crv"] = "P-224"
+
+	tests := []struct {
+		name string
+		raw  []byte
+		want string
+	}{
+		{"not json", []byte("{"), "unexpected end of JSON input"},
+		{"unknown key type", jwksJSON(t, map[string]string{"kty": "OKP"}), `unsupported key type "OKP"`},
+		{"unsupported curve", jwksJSON(t, otherCurve), `unsupported curve "P-224"`},
+		{"point off the curve", jwksJSON(t, offCurve), "not on curve"},
+		{"bad modulus", jwksJSON(t, map[string]string{"kty": "RSA", "n": "!", "e": "AQAB"}), "modulus"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseJWKS(tt.raw); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("ParseJWKS = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+}
+
+// syncBuffer lets a test read the logs while WatchJWKSFile writes them.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) count(s string) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return strings.Count(b.buf.String(), s)
+}
+
+func TestWatchJWKSFileKeepsKeysOnBadReload(t *testing.T) {
+	oldKey, newKey := rsaKey(t), rsaKey(t)
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	modTime := time.Now()
+	write := func(raw []byte) {
+		t.Helper()
+		if err := os.WriteFile(path, raw, 0o600); err != nil {
+			t.Fatal(err)
+		}
+		// Move the modification time on so the watcher sees every write.
+		modTime = modTime.Add(time.Second)
+		if err := os.Chtimes(path, modTime, modTime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	waitFor := func(what string, done func() bool) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for !done() {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+			time.Sleep(5 * time.Millisecond)
+		}
+	}
+
+	oldFile := jwksJSON(t, rsaJWK("old", &oldKey.PublicKey))
+	write(oldFile)
+	ks := NewKeySet()
+	if err := ks.LoadJWKSFile(path); err != nil {
+		t.Fatalf("LoadJWKSFile: %v", err)
+	}
+
+	var logs syncBuffer
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go ks.WatchJWKSFile(ctx, jsonlog.New(&logs, jsonlog.LevelInfo), path, 10*time.Millisecond)
+
+	// The watcher notes the file as it starts, so touch it until a reload shows it runs.
+	waitFor("the watcher to start", func() bool {
+		write(oldFile)
+		return logs.count("reloaded JWKS file") > 0
+	})
+	oldToken := sign(t, jwt.SigningMethodRS256, oldKey, "old")
+	write([]byte(`{"keys": [{"kty": "RSA", "kid": "new", "n": "half-writ`))
+	waitFor("the bad file to be reported", func() bool { return logs.count("auth.ParseJWKS") > 0 })
+	if err := parse(ks, oldToken); err != nil {
+		t.Fatalf("token signed with the old key after a bad reload: %v", err)
+	}
+
+	reloads := logs.count("reloaded JWKS file")
+	write(jwksJSON(t, rsaJWK("new", &newKey.PublicKey)))
+	waitFor("the new file to be loaded", func() bool { return logs.count("reloaded JWKS file") > reloads })
+	if err := parse(ks, sign(t, jwt.SigningMethodRS256, newKey, "new")); err != nil {
+		t.Fatalf("token signed with the new key: %v", err)
+	}
+	if err := parse(ks, oldToken); err == nil {
+		t.Fatal("token signed with a key no longer in the file accepted")
+	}
+}
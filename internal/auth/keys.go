@@ -0,0 +1,104 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var (
+	ErrUnknownKeyID = errors.New("auth: unknown key id")
+	ErrNoKey        = errors.New("auth: no key for signing algorithm")
+)
+
+// Key is a single verification key. Algorithm pins the key to one JWT "alg"; when it
+// is empty every algorithm of the key's family (HS*, RS*/PS*, ES*) is accepted.
+type Key struct {
+	ID        string
+	Algorithm string
+	// Key is a []byte HMAC secret, *rsa.PublicKey or *ecdsa.PublicKey.
+	Key any
+}
+
+// KeySet holds the keys tokens may be signed with. Static keys come from flags and
+// never change; file keys are replaced wholesale on every JWKS reload. Keeping both
+// the old and the new key in the set is how signing keys are rotated.
+type KeySet struct {
+	mu     sync.RWMutex
+	static []Key
+	file   []Key
+}
+
+func NewKeySet(static ...Key) *KeySet {
+	return &KeySet{static: static}
+}
+
+func (ks *KeySet) setFileKeys(keys []Key) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+	ks.file = keys
+}
+
+func (ks *KeySet) Len() int {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+	return len(ks.static) + len(ks.file)
+}
+
+// Keyfunc selects the verification keys for token. With a "kid" header only that key
+// is used; without one every key compatible with the token's algorithm is tried.
+func (ks *KeySet) Keyfunc(token *jwt.Token) (interface{}, error) {
+	alg := token.Method.Alg()
+	kid, _ := token.Header["kid"].(string)
+
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	var candidates []jwt.VerificationKey
+	for _, keys := range [][]Key{ks.file, ks.static} {
+		for _, k := range keys {
+			if kid != "" && k.ID != kid {
+				continue
+			}
+			if !k.accepts(alg) {
+				if kid != "" {
+					return nil, fmt.Errorf("auth: key %q cannot verify %s tokens", kid, alg)
+				}
+				continue
+			}
+			candidates = append(candidates, k.Key)
+		}
+	}
+
+	switch {
+	case len(candidates) == 1:
+		return candidates[0], nil
+	case len(candidates) > 1:
+		return jwt.VerificationKeySet{Keys: candidates}, nil
+	case kid != "":
+		return nil, fmt.Errorf("%w %q", ErrUnknownKeyID, kid)
+	default:
+		return nil, fmt.Errorf("%w %s", ErrNoKey, alg)
+	}
+}
+
+func (k Key) accepts(alg string) bool {
+	if k.Algorithm != "" {
+		return k.Algorithm == alg
+	}
+	switch k.Key.(type) {
+	case []byte:
+		return strings.HasPrefix(alg, "HS")
+	case *rsa.PublicKey:
+		return strings.HasPrefix(alg, "RS") || strings.HasPrefix(alg, "PS")
+	case *ecdsa.PublicKey:
+		return strings.HasPrefix(alg, "ES")
+	default:
+		return false
+	}
+}
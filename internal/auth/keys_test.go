@@ -0,0 +1,110 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// sign signs a token valid for an hour with method and key, with a "kid" header when
+// kid is not empty.
+func sign(t *testing.T, method jwt.SigningMethod, key any, kid string) string {
+	t.Helper()
+	token := jwt.NewWithClaims(method, jwt.MapClaims{
+		"user_id": "1",
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	})
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func rsaKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return key
+}
+
+func parse(ks *KeySet, token string) error {
+	_, err := jwt.Parse(token, ks.Keyfunc)
+	return err
+}
+
+func TestKeyfuncSelectsKeyByKid(t *testing.T) {
+	ks := NewKeySet(
+		Key{ID: "a", Key: []byte("secret-a")},
+		Key{ID: "b", Key: []byte("secret-b")},
+	)
+
+	if err := parse(ks, sign(t, jwt.SigningMethodHS256, []byte("secret-b"), "b")); err != nil {
+		t.Fatalf("token signed with key b: %v", err)
+	}
+	if err := parse(ks, sign(t, jwt.SigningMethodHS256, []byte("secret-b"), "a")); !errors.Is(err, jwt.ErrSignatureInvalid) {
+		t.Fatalf("token signed with key b but naming a: %v, want an invalid signature", err)
+	}
+	if err := parse(ks, sign(t, jwt.SigningMethodHS256, []byte("secret-b"), "c")); !errors.Is(err, ErrUnknownKeyID) {
+		t.Fatalf("token naming an unknown key: %v, want ErrUnknownKeyID", err)
+	}
+}
+
+func TestKeyfuncAcceptsOverlappingKeysDuringRotation(t *testing.T) {
+	oldKey, newKey := rsaKey(t), rsaKey(t)
+	ks := NewKeySet()
+	ks.setFileKeys([]Key{{Key: &oldKey.PublicKey}, {Key: &newKey.PublicKey}})
+
+	oldToken := sign(t, jwt.SigningMethodRS256, oldKey, "")
+	newToken := sign(t, jwt.SigningMethodRS256, newKey, "")
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		if err := parse(ks, token); err != nil {
+			t.Fatalf("token signed with the %s key while both are active: %v", name, err)
+		}
+	}
+
+	ks.setFileKeys([]Key{{Key: &newKey.PublicKey}})
+	if err := parse(ks, newToken); err != nil {
+		t.Fatalf("token signed with the new key: %v", err)
+	}
+	if err := parse(ks, oldToken); err == nil {
+		t.Fatal("token signed with the retired key accepted")
+	}
+}
+
+func TestKeyfuncRejectsAlgorithmOfAnotherKeyType(t *testing.T) {
+	key := rsaKey(t)
+	// Signing HS256 with the public key is the classic algorithm confusion attack.
+	public, err := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		keys []Key
+		kid  string
+	}{
+		{"with kid", []Key{{ID: "rsa", Key: &key.PublicKey}}, "rsa"},
+		{"without kid", []Key{{Key: &key.PublicKey}}, ""},
+		{"pinned algorithm", []Key{{Algorithm: "RS256", Key: public}}, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ks := NewKeySet(tt.keys...)
+			if err := parse(ks, sign(t, jwt.SigningMethodHS256, public, tt.kid)); !errors.Is(err, jwt.ErrTokenUnverifiable) {
+				t.Fatalf("HS256 token against an RSA key: %v, want it unverifiable", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+var ErrInvalidToken = errors.New("auth: invalid token")
+
+type Config struct {
+	// Algorithms lists the accepted "alg" values, e.g. HS256, RS256, ES256.
+	Algorithms []string
+	// Issuer and Audience, when set, must match the "iss" and "aud" claims.
+	Issuer   string
+	Audience string
+	// Leeway is the allowed clock skew when checking "exp", "nbf" and "iat".
+	Leeway time.Duration
+}
+
+// Verifier checks bearer tokens against a KeySet.
+type Verifier struct {
+	keys   *KeySet
+	parser *jwt.Parser
+}
+
+func NewVerifier(keys *KeySet, cfg Config) *Verifier {
+	opts := []jwt.ParserOption{
+		jwt.WithValidMethods(cfg.Algorithms),
+		jwt.WithJSONNumber(),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(cfg.Leeway),
+	}
+	if cfg.Issuer != "" {
+		opts = append(opts, jwt.WithIssuer(cfg.Issuer))
+	}
+	if cfg.Audience != "" {
+		opts = append(opts, jwt.WithAudience(cfg.Audience))
+	}
+
+	return &Verifier{
+		keys:   keys,
+		parser: jwt.NewParser(opts...),
+	}
+}
+
+// Verify checks the signature, "exp" (required), "nbf", "iat", "iss" and "aud" of
+// tokenStr and returns its application claims.
+func (v *Verifier) Verify(tokenStr string) (*Claims, error) {
+	raw := jwt.MapClaims{}
+	token, err := v.parser.ParseWithClaims(tokenStr, raw, v.keys.Keyfunc)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if !token.Valid {
+		return nil, ErrInvalidToken
+	}
+	return claimsFromMap(raw)
+}
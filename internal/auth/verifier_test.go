@@ -0,0 +1,202 @@
+package auth
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const testSecret = "verifier-secret"
+
+func mint(t *testing.T, claims jwt.MapClaims) string {
+	t.Helper()
+	s, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(testSecret))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+func TestVerify(t *testing.T) {
+	now := time.Now()
+	valid := func(extra jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"user_id": "1",
+			"iat":     now.Unix(),
+			"exp":     now.Add(time.Hour).Unix(),
+		}
+		for k, v := range extra {
+			if v == nil {
+				delete(claims, k)
+				continue
+			}
+			claims[k] = v
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name   string
+		cfg    Config
+		claims jwt.MapClaims
+		ok     bool
+	}{
+		{"valid", Config{}, valid(nil), true},
+		{"no exp", Config{}, valid(jwt.MapClaims{"exp": nil}), false},
+		{"expired", Config{}, valid(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()}), false},
+		{"expired within leeway", Config{Leeway: 2 * time.Minute}, valid(jwt.MapClaims{"exp": now.Add(-time.Minute).Unix()}), true},
+		{"not yet valid", Config{}, valid(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()}), false},
+		{"not yet valid within leeway", Config{Leeway: 2 * time.Minute}, valid(jwt.MapClaims{"nbf": now.Add(time.Minute).Unix()}), true},
+		{"issued in the future", Config{}, valid(jwt.MapClaims{"iat": now.Add(time.Minute).Unix()}), false},
+		{"issuer", Config{Issuer: "auth"}, valid(jwt.MapClaims{"iss": "auth"}), true},
+		{"wrong issuer", Config{Issuer: "auth"}, valid(jwt.MapClaims{"iss": "other"}), false},
+		{"missing issuer", Config{Issuer: "auth"}, valid(nil), false},
+		{"audience", Config{Audience: "cart"}, valid(jwt.MapClaims{"aud": []string{"toys", "cart"}}), true},
+		{"wrong audience", Config{Audience: "cart"}, valid(jwt.MapClaims{"aud": "toys"}), false},
+		{"missing audience", Config{Audience: "cart"}, valid(nil), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.cfg.Algorithms = []string{"HS256"}
+			v := NewVerifier(NewKeySet(Key{Key: []byte(testSecret)}), tt.cfg)
+
+			claims, err := v.Verify(mint(t, tt.claims))
+			if tt.ok && (err != nil || claims.UserID != 1) {
+				t.Fatalf("Verify = %+v, %v, want user 1", claims, err)
+			}
+			if !tt.ok && !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("Verify = %+v, %v, want ErrInvalidToken", claims, err)
+			}
+		})
+	}
+}
+
+func TestVerifyRejectsAlgorithmNotListed(t *testing.T) {
+	v := NewVerifier(NewKeySet(Key{Key: []byte(testSecret)}), Config{Algorithms: []string{"HS512"}})
+	token := mint(t, jwt.MapClaims{"user_id": "1", "exp": time.Now().Add(time.Hour).Unix()})
+	if _, err := v.Verify(token); !errors.Is(err, jwt.ErrTokenSignatureInvalid) {
+		t.Fatalf("HS256 token with only HS512 allowed: %v, want an invalid signature", err)
+	}
+}
+
+func TestClaimsFromMap(t *testing.T) {
+	exp := time.Unix(1_700_000_000, 0)
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		want    *Claims
+		wantErr bool
+	}{
+		{
+			name:   "user id as a string",
+			claims: jwt.MapClaims{"user_id": "42"},
+			want:   &Claims{UserID: 42},
+		},
+		{
+			name:   "user id as a number",
+			claims: jwt.MapClaims{"user_id": json.Number("9007199254740993")},
+			want:   &Claims{UserID: 9007199254740993},
+		},
+		{
+			name:    "user id too large for int64",
+			claims:  jwt.MapClaims{"user_id": json.Number("9223372036854775808")},
+			wantErr: true,
+		},
+		{
+			name:    "user id not positive",
+			claims:  jwt.MapClaims{"user_id": "0"},
+			wantErr: true,
+		},
+		{
+			name:    "user id not a number",
+			claims:  jwt.MapClaims{"user_id": "alice"},
+			wantErr: true,
+		},
+		{
+			name:    "user id of another type",
+			claims:  jwt.MapClaims{"user_id": true},
+			wantErr: true,
+		},
+		{
+			name:   "falls back to sub",
+			claims: jwt.MapClaims{"sub": "7"},
+			want:   &Claims{UserID: 7},
+		},
+		{
+			name:   "user id preferred over sub",
+			claims: jwt.MapClaims{"user_id": "42", "sub": "7"},
+			want:   &Claims{UserID: 42},
+		},
+		{
+			name:    "no user id",
+			claims:  jwt.MapClaims{"plan": "pro"},
+			wantErr: true,
+		},
+		{
+			name: "roles as an array",
+			claims: jwt.MapClaims{
+				"user_id": "1",
+				"roles":   []any{"admin", "", 3, "support"},
+			},
+			want: &Claims{UserID: 1, Roles: []string{"admin", "support"}},
+		},
+		{
+			name: "roles as a string and a single role",
+			claims: jwt.MapClaims{
+				"user_id": "1",
+				"roles":   "admin, support",
+				"role":    "auditor",
+			},
+			want: &Claims{UserID: 1, Roles: []string{"admin", "support", "auditor"}},
+		},
+		{
+			name: "single role already listed",
+			claims: jwt.MapClaims{
+				"user_id": "1",
+				"roles":   []any{"admin"},
+				"role":    "admin",
+			},
+			want: &Claims{UserID: 1, Roles: []string{"admin"}},
+		},
+		{
+			name: "plan, tenant and expiry",
+			claims: jwt.MapClaims{
+				"user_id": "1",
+				"plan":    "pro",
+				"tenant":  "acme",
+				"exp":     json.Number("1700000000"),
+			},
+			want: &Claims{UserID: 1, Plan: "pro", Tenant: "acme", ExpiresAt: exp},
+		},
+		{
+			name: "numeric tenant_id",
+			claims: jwt.MapClaims{
+				"user_id":   "1",
+				"tenant_id": json.Number("12"),
+			},
+			want: &Claims{UserID: 1, Tenant: "12"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := claimsFromMap(tt.claims)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidUserID) {
+					t.Fatalf("claimsFromMap = %+v, %v, want ErrInvalidUserID", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("claimsFromMap: %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("claimsFromMap = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
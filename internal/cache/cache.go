@@ -0,0 +1,20 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var ErrMiss = errors.New("cache: miss")
+
+// Cache is a byte oriented key/value store with per-key expiry. Implementations
+// must be safe for concurrent use.
+type Cache interface {
+	// Get returns ErrMiss when the key is absent or expired.
+	Get(ctx context.Context, key string) ([]byte, error)
+	// Set stores value under key; a zero ttl means the entry never expires.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, keys ...string) error
+	Close() error
+}
@@ -0,0 +1,303 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var ErrClosed = errors.New("cache: client is closed")
+
+// RedisError is an error reply sent by the server, e.g. "WRONGTYPE ...". Unlike I/O
+// errors it leaves the connection usable.
+type RedisError string
+
+func (e RedisError) Error() string {
+	return "redis: " + string(e)
+}
+
+type RedisOptions struct {
+	Addr        string
+	Password    string
+	DB          int
+	DialTimeout time.Duration
+	// IOTimeout bounds every command when the context has no earlier deadline.
+	IOTimeout time.Duration
+	// PoolSize is the number of idle connections kept for reuse.
+	PoolSize int
+}
+
+// Redis is a minimal client for servers speaking the RESP2 protocol (Redis, KeyDB,
+// Dragonfly). It implements Cache and exposes Do for any other command.
+type Redis struct {
+	opts RedisOptions
+	idle chan *respConn
+
+	mu     sync.Mutex
+	closed bool
+}
+
+type respConn struct {
+	conn net.Conn
+	r    *bufio.Reader
+	w    *bufio.Writer
+}
+
+func NewRedis(opts RedisOptions) *Redis {
+	if opts.DialTimeout <= 0 {
+		opts.DialTimeout = 2 * time.Second
+	}
+	if opts.IOTimeout <= 0 {
+		opts.IOTimeout = time.Second
+	}
+	if opts.PoolSize <= 0 {
+		opts.PoolSize = 10
+	}
+	return &Redis{
+		opts: opts,
+		idle: make(chan *respConn, opts.PoolSize),
+	}
+}
+
+func (r *Redis) Get(ctx context.Context, key string) ([]byte, error) {
+	reply, err := r.Do(ctx, "GET", key)
+	if err != nil {
+		return nil, err
+	}
+	switch v := reply.(type) {
+	case nil:
+		return nil, ErrMiss
+	case []byte:
+		return v, nil
+	default:
+		return nil, fmt.Errorf("redis: unexpected GET reply %T", reply)
+	}
+}
+
+func (r *Redis) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	args := []string{"SET", key, string(value)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+	_, err := r.Do(ctx, args...)
+	return err
+}
+
+func (r *Redis) Delete(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	_, err := r.Do(ctx, append([]string{"DEL"}, keys...)...)
+	return err
+}
+
+func (r *Redis) Ping(ctx context.Context) error {
+	_, err := r.Do(ctx, "PING")
+	return err
+}
+
+// Do sends a single command and returns its reply decoded as string (simple strings),
+// int64 (integers), []byte (bulk strings), []any (arrays) or nil (null replies).
+func (r *Redis) Do(ctx context.Context, args ...string) (any, error) {
+	c, err := r.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deadline := time.Now().Add(r.opts.IOTimeout)
+	if d, ok := ctx.Deadline(); ok && d.Before(deadline) {
+		deadline = d
+	}
+	if err := c.conn.SetDeadline(deadline); err != nil {
+		c.conn.Close()
+		return nil, err
+	}
+
+	reply, err := c.do(args)
+	var redisErr RedisError
+	if err != nil && !errors.As(err, &redisErr) {
+		c.conn.Close()
+		return nil, err
+	}
+
+	r.put(c)
+	return reply, err
+}
+
+func (r *Redis) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return nil
+	}
+	r.closed = true
+	close(r.idle)
+	for c := range r.idle {
+		c.conn.Close()
+	}
+	return nil
+}
+
+func (r *Redis) get(ctx context.Context) (*respConn, error) {
+	r.mu.Lock()
+	closed := r.closed
+	r.mu.Unlock()
+	if closed {
+		return nil, ErrClosed
+	}
+
+	select {
+	case c, ok := <-r.idle:
+		if ok {
+			return c, nil
+		}
+		return nil, ErrClosed
+	default:
+	}
+
+	return r.dial(ctx)
+}
+
+func (r *Redis) put(c *respConn) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		c.conn.Close()
+		return
+	}
+	select {
+	case r.idle <- c:
+	default:
+		c.conn.Close()
+	}
+}
+
+func (r *Redis) dial(ctx context.Context) (*respConn, error) {
+	d := net.Dialer{Timeout: r.opts.DialTimeout}
+	conn, err := d.DialContext(ctx, "tcp", r.opts.Addr)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", "cache.Redis.dial", err)
+	}
+
+	c := &respConn{
+		conn: conn,
+		r:    bufio.NewReader(conn),
+		w:    bufio.NewWriter(conn),
+	}
+
+	if err := conn.SetDeadline(time.Now().Add(r.opts.IOTimeout)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	if r.opts.Password != "" {
+		if _, err := c.do([]string{"AUTH", r.opts.Password}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: %w", "cache.Redis.dial", err)
+		}
+	}
+	if r.opts.DB != 0 {
+		if _, err := c.do([]string{"SELECT", strconv.Itoa(r.opts.DB)}); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("%s: %w", "cache.Redis.dial", err)
+		}
+	}
+	return c, nil
+}
+
+func (c *respConn) do(args []string) (any, error) {
+	if err := c.writeCommand(args); err != nil {
+		return nil, err
+	}
+	return c.readReply()
+}
+
+func (c *respConn) writeCommand(args []string) error {
+	c.w.WriteString("*")
+	c.w.WriteString(strconv.Itoa(len(args)))
+	c.w.WriteString("\r\n")
+	for _, arg := range args {
+		c.w.WriteString("$")
+		c.w.WriteString(strconv.Itoa(len(arg)))
+		c.w.WriteString("\r\n")
+		c.w.WriteString(arg)
+		c.w.WriteString("\r\n")
+	}
+	return c.w.Flush()
+}
+
+func (c *respConn) readReply() (any, error) {
+	line, err := c.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if len(line) == 0 {
+		return nil, errors.New("redis: empty reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, RedisError(line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed bulk length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("redis: malformed array length %q", line)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		items := make([]any, n)
+		var firstErr error
+		for i := range items {
+			items[i], err = c.readReply()
+			if err != nil {
+				var redisErr RedisError
+				if !errors.As(err, &redisErr) {
+					return nil, err
+				}
+				// Keep reading so the connection stays in sync with the server.
+				if firstErr == nil {
+					firstErr = err
+				}
+			}
+		}
+		return items, firstErr
+	default:
+		return nil, fmt.Errorf("redis: unknown reply type %q", line[0])
+	}
+}
+
+func (c *respConn) readLine() (string, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return "", err
+	}
+	if len(line) < 2 || line[len(line)-2] != '\r' {
+		return "", fmt.Errorf("redis: malformed reply line %q", line)
+	}
+	return line[:len(line)-2], nil
+}
@@ -0,0 +1,322 @@
+package cache
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// respStub is a local stand-in for a Redis server. It understands the commands the
+// client sends, records them and answers unknown ones with an error reply.
+type respStub struct {
+	ln       net.Listener
+	password string
+
+	mu       sync.Mutex
+	values   map[string][]byte
+	expires  map[string]time.Time
+	commands [][]string
+	accepted int
+	open     int
+}
+
+func startStub(t *testing.T, password string) *respStub {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &respStub{
+		ln:       ln,
+		password: password,
+		values:   make(map[string][]byte),
+		expires:  make(map[string]time.Time),
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			s.mu.Lock()
+			s.accepted++
+			s.open++
+			s.mu.Unlock()
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *respStub) client(opts RedisOptions) *Redis {
+	opts.Addr = s.ln.Addr().String()
+	return NewRedis(opts)
+}
+
+func (s *respStub) serve(conn net.Conn) {
+	defer func() {
+		conn.Close()
+		s.mu.Lock()
+		s.open--
+		s.mu.Unlock()
+	}()
+
+	r := bufio.NewReader(conn)
+	authed := s.password == ""
+	for {
+		args, err := readCommand(r)
+		if err != nil {
+			return
+		}
+		s.mu.Lock()
+		s.commands = append(s.commands, args)
+		reply := s.handle(args, &authed)
+		s.mu.Unlock()
+		if _, err := io.WriteString(conn, reply); err != nil {
+			return
+		}
+	}
+}
+
+func (s *respStub) handle(args []string, authed *bool) string {
+	cmd := strings.ToUpper(args[0])
+	if cmd == "AUTH" {
+		if len(args) == 2 && args[1] == s.password {
+			*authed = true
+			return "+OK\r\n"
+		}
+		return "-WRONGPASS invalid username-password pair\r\n"
+	}
+	if !*authed {
+		return "-NOAUTH Authentication required.\r\n"
+	}
+
+	switch cmd {
+	case "PING":
+		return "+PONG\r\n"
+	case "SELECT":
+		return "+OK\r\n"
+	case "GET":
+		v, ok := s.values[args[1]]
+		if exp, has := s.expires[args[1]]; has && time.Now().After(exp) {
+			ok = false
+		}
+		if !ok {
+			return "$-1\r\n"
+		}
+		return fmt.Sprintf("$%d\r\n%s\r\n", len(v), v)
+	case "SET":
+		s.values[args[1]] = []byte(args[2])
+		delete(s.expires, args[1])
+		if len(args) == 5 && strings.ToUpper(args[3]) == "PX" {
+			ms, _ := strconv.Atoi(args[4])
+			s.expires[args[1]] = time.Now().Add(time.Duration(ms) * time.Millisecond)
+		}
+		return "+OK\r\n"
+	case "DEL":
+		n := 0
+		for _, key := range args[1:] {
+			if _, ok := s.values[key]; ok {
+				n++
+			}
+			delete(s.values, key)
+			delete(s.expires, key)
+		}
+		return ":" + strconv.Itoa(n) + "\r\n"
+	default:
+		return "-ERR unknown command '" + args[0] + "'\r\n"
+	}
+}
+
+func readCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "*")))
+	if err != nil {
+		return nil, err
+	}
+	args := make([]string, n)
+	for i := range args {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		size, err := strconv.Atoi(strings.TrimSpace(strings.TrimPrefix(line, "$")))
+		if err != nil {
+			return nil, err
+		}
+		buf := make([]byte, size+2)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return nil, err
+		}
+		args[i] = string(buf[:size])
+	}
+	return args, nil
+}
+
+func (s *respStub) lastCommand() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.commands[len(s.commands)-1]
+}
+
+func (s *respStub) stats() (accepted, open int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.accepted, s.open
+}
+
+func TestRedisGetMiss(t *testing.T) {
+	r := startStub(t, "").client(RedisOptions{})
+	defer r.Close()
+
+	if _, err := r.Get(context.Background(), "missing"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get: %v, want ErrMiss", err)
+	}
+}
+
+func TestRedisSet(t *testing.T) {
+	stub := startStub(t, "")
+	r := stub.client(RedisOptions{})
+	defer r.Close()
+	ctx := context.Background()
+
+	if err := r.Set(ctx, "k", []byte("v\r\nwith a line break"), 1500*time.Millisecond); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got := strings.Join(stub.lastCommand(), " "); got != "SET k v\r\nwith a line break PX 1500" {
+		t.Fatalf("sent %q", got)
+	}
+	got, err := r.Get(ctx, "k")
+	if err != nil || string(got) != "v\r\nwith a line break" {
+		t.Fatalf("Get = %q, %v", got, err)
+	}
+
+	if err := r.Set(ctx, "forever", []byte("v"), 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if got := stub.lastCommand(); len(got) != 3 {
+		t.Fatalf("Set without ttl sent %q, want no PX", got)
+	}
+
+	if err := r.Set(ctx, "short", []byte("v"), 20*time.Millisecond); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+	if _, err := r.Get(ctx, "short"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get after PX expiry: %v, want ErrMiss", err)
+	}
+}
+
+func TestRedisDelete(t *testing.T) {
+	stub := startStub(t, "")
+	r := stub.client(RedisOptions{})
+	defer r.Close()
+	ctx := context.Background()
+
+	r.Set(ctx, "a", []byte("1"), 0)
+	r.Set(ctx, "b", []byte("2"), 0)
+	if err := r.Delete(ctx, "a", "b"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if got := strings.Join(stub.lastCommand(), " "); got != "DEL a b" {
+		t.Fatalf("sent %q", got)
+	}
+	if _, err := r.Get(ctx, "a"); !errors.Is(err, ErrMiss) {
+		t.Fatalf("Get after Delete: %v, want ErrMiss", err)
+	}
+
+	if err := r.Delete(ctx); err != nil {
+		t.Fatalf("Delete without keys: %v", err)
+	}
+	if got := stub.lastCommand()[0]; got != "GET" {
+		t.Fatalf("Delete without keys sent %s", got)
+	}
+}
+
+func TestRedisErrorReplyKeepsConnection(t *testing.T) {
+	stub := startStub(t, "")
+	r := stub.client(RedisOptions{})
+	defer r.Close()
+	ctx := context.Background()
+
+	_, err := r.Do(ctx, "BOGUS")
+	var redisErr RedisError
+	if !errors.As(err, &redisErr) || !strings.HasPrefix(string(redisErr), "ERR unknown command") {
+		t.Fatalf("Do(BOGUS): %v, want an ERR reply", err)
+	}
+	if err := r.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if accepted, _ := stub.stats(); accepted != 1 {
+		t.Fatalf("%d connections dialled, want the first one reused", accepted)
+	}
+}
+
+func TestRedisAuthSelect(t *testing.T) {
+	stub := startStub(t, "s3cret")
+	r := stub.client(RedisOptions{Password: "s3cret", DB: 2})
+	defer r.Close()
+
+	if err := r.Ping(context.Background()); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	stub.mu.Lock()
+	var sent []string
+	for _, cmd := range stub.commands {
+		sent = append(sent, strings.Join(cmd, " "))
+	}
+	stub.mu.Unlock()
+	if got := strings.Join(sent, ", "); got != "AUTH s3cret, SELECT 2, PING" {
+		t.Fatalf("sent %q", got)
+	}
+
+	wrong := stub.client(RedisOptions{Password: "nope"})
+	defer wrong.Close()
+	var redisErr RedisError
+	if err := wrong.Ping(context.Background()); !errors.As(err, &redisErr) {
+		t.Fatalf("Ping with a wrong password: %v, want a WRONGPASS reply", err)
+	}
+}
+
+func TestRedisClose(t *testing.T) {
+	stub := startStub(t, "")
+	r := stub.client(RedisOptions{})
+	ctx := context.Background()
+
+	if err := r.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatalf("second Close: %v", err)
+	}
+	if _, err := r.Get(ctx, "k"); !errors.Is(err, ErrClosed) {
+		t.Fatalf("Get after Close: %v, want ErrClosed", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if _, open := stub.stats(); open == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("pooled connection still open after Close")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
@@ -0,0 +1,325 @@
+package breaker
+
+import (
+	"cartService/internal/jsonlog"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+)
+
+// ErrUpstreamUnavailable matches every *UnavailableError with errors.Is.
+var ErrUpstreamUnavailable = errors.New("upstream unavailable")
+
+// UnavailableError is returned instead of calling a service whose breaker is open.
+type UnavailableError struct {
+	Service    string
+	RetryAfter time.Duration
+}
+
+func (e *UnavailableError) Error() string {
+	return fmt.Sprintf("%s: %s, retry after %s", e.Service, ErrUpstreamUnavailable, e.RetryAfter.Round(time.Second))
+}
+
+func (e *UnavailableError) Is(target error) bool {
+	return target == ErrUpstreamUnavailable
+}
+
+// GRPCStatus lets the error cross gRPC boundaries as codes.Unavailable.
+func (e *UnavailableError) GRPCStatus() *status.Status {
+	return status.New(codes.Unavailable, e.Error())
+}
+
+type State int
+
+const (
+	StateClosed State = iota
+	StateOpen
+	StateHalfOpen
+)
+
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateOpen:
+		return "open"
+	case StateHalfOpen:
+		return "half-open"
+	default:
+		return "unknown"
+	}
+}
+
+// Outcome is what a call let through by Allow tells the breaker about the upstream.
+type Outcome int
+
+const (
+	Success Outcome = iota
+	Failure
+	// Ignored counts the call neither way, e.g. when the caller gave up on it. A
+	// half-open probe slot it held is freed for another call.
+	Ignored
+)
+
+type Config struct {
+	// Window is the period the failure rate is computed over.
+	Window time.Duration `yaml:"window"`
+	// MinRequests is the number of calls in the window below which the breaker never
+	// opens, so a single failure on a quiet service doesn't trip it.
+	MinRequests int `yaml:"min_requests"`
+	// FailureRate in (0, 1] opens the breaker once reached.
+	FailureRate float64 `yaml:"failure_rate"`
+	// OpenTimeout is how long the breaker stays open before probing again.
+	OpenTimeout time.Duration `yaml:"open_timeout"`
+	// HalfOpenRequests is the number of probe calls let through when half-open; all
+	// of them must succeed to close the breaker.
+	HalfOpenRequests int `yaml:"half_open_requests"`
+}
+
+// Enabled reports whether cfg describes a working breaker.
+func (c Config) Enabled() bool {
+	return c.FailureRate > 0 && c.Window > 0
+}
+
+var breakerStats = expvar.NewMap("circuit_breakers")
+
+const buckets = 10
+
+type bucket struct {
+	start    time.Time
+	total    int
+	failures int
+}
+
+// Breaker is a failure-rate circuit breaker. Calls are counted in a sliding window of
+// ten buckets; when the failure rate in the window reaches FailureRate the breaker
+// opens and calls fail fast with *UnavailableError until OpenTimeout has passed.
+type Breaker struct {
+	name string
+	cfg  Config
+	log  *jsonlog.Logger
+	now  func() time.Time
+
+	mu       sync.Mutex
+	state    State
+	openedAt time.Time
+	window   [buckets]bucket
+	probes   int
+	probeOK  int
+	// generation changes with every state change, so outcomes of calls let through
+	// in an earlier state are dropped.
+	generation uint64
+
+	stats     *expvar.Map
+	stateVar  *expvar.String
+	rejected  *expvar.Int
+	openCount *expvar.Int
+}
+
+func New(name string, cfg Config, log *jsonlog.Logger) *Breaker {
+	if cfg.MinRequests <= 0 {
+		cfg.MinRequests = 10
+	}
+	if cfg.OpenTimeout <= 0 {
+		cfg.OpenTimeout = 30 * time.Second
+	}
+	if cfg.HalfOpenRequests <= 0 {
+		cfg.HalfOpenRequests = 1
+	}
+
+	b := &Breaker{
+		name:      name,
+		cfg:       cfg,
+		log:       log,
+		now:       time.Now,
+		stats:     new(expvar.Map).Init(),
+		stateVar:  new(expvar.String),
+		rejected:  new(expvar.Int),
+		openCount: new(expvar.Int),
+	}
+	b.stateVar.Set(StateClosed.String())
+	b.stats.Set("state", b.stateVar)
+	b.stats.Set("rejected", b.rejected)
+	b.stats.Set("opened", b.openCount)
+	breakerStats.Set(name, b.stats)
+	return b
+}
+
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.advanceLocked()
+	return b.state
+}
+
+// Allow reports whether a call may be made. When it may, done must be called with
+// the outcome of the call.
+func (b *Breaker) Allow() (done func(Outcome), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.advanceLocked()
+	switch b.state {
+	case StateOpen:
+		b.rejected.Add(1)
+		return nil, &UnavailableError{Service: b.name, RetryAfter: b.openedAt.Add(b.cfg.OpenTimeout).Sub(b.now())}
+	case StateHalfOpen:
+		if b.probes >= b.cfg.HalfOpenRequests {
+			b.rejected.Add(1)
+			return nil, &UnavailableError{Service: b.name, RetryAfter: b.cfg.OpenTimeout}
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(o Outcome) {
+		b.record(generation, o)
+	}, nil
+}
+
+func (b *Breaker) record(generation uint64, o Outcome) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if generation != b.generation {
+		// The breaker changed state while the call ran; its outcome no longer matters.
+		return
+	}
+
+	switch b.state {
+	case StateHalfOpen:
+		switch o {
+		case Ignored:
+			b.probes--
+		case Failure:
+			b.setStateLocked(StateOpen)
+		case Success:
+			b.probeOK++
+			if b.probeOK >= b.cfg.HalfOpenRequests {
+				b.setStateLocked(StateClosed)
+			}
+		}
+		return
+	case StateOpen:
+		return
+	}
+
+	if o == Ignored {
+		return
+	}
+	bk := b.bucketLocked()
+	bk.total++
+	if o == Failure {
+		bk.failures++
+	}
+
+	total, failures := b.countsLocked()
+	if total >= b.cfg.MinRequests && float64(failures)/float64(total) >= b.cfg.FailureRate {
+		b.setStateLocked(StateOpen)
+	}
+}
+
+// advanceLocked moves an open breaker to half-open once OpenTimeout has passed.
+func (b *Breaker) advanceLocked() {
+	if b.state == StateOpen && b.now().Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.setStateLocked(StateHalfOpen)
+	}
+}
+
+func (b *Breaker) setStateLocked(s State) {
+	if b.state == s {
+		return
+	}
+	from := b.state
+	b.state = s
+	b.generation++
+	b.probes, b.probeOK = 0, 0
+
+	switch s {
+	case StateOpen:
+		b.openedAt = b.now()
+		b.openCount.Add(1)
+	case StateClosed:
+		b.window = [buckets]bucket{}
+	}
+	b.stateVar.Set(s.String())
+
+	b.log.PrintInfo("circuit breaker state changed", map[string]string{
+		"method":  "breaker.setState",
+		"breaker": b.name,
+		"from":    from.String(),
+		"to":      s.String(),
+	})
+}
+
+func (b *Breaker) bucketLocked() *bucket {
+	width := b.cfg.Window / buckets
+	now := b.now()
+	start := now.Truncate(width)
+	bk := &b.window[(start.UnixNano()/int64(width))%buckets]
+	if !bk.start.Equal(start) {
+		*bk = bucket{start: start}
+	}
+	return bk
+}
+
+func (b *Breaker) countsLocked() (total, failures int) {
+	cutoff := b.now().Add(-b.cfg.Window)
+	for _, bk := range b.window {
+		if bk.start.After(cutoff) {
+			total += bk.total
+			failures += bk.failures
+		}
+	}
+	return total, failures
+}
+
+// IsFailure decides which call errors count against the upstream. Errors caused by
+// the caller (bad arguments, missing permissions, cancellation) don't.
+func IsFailure(err error) bool {
+	if err == nil {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal, codes.Unknown, codes.ResourceExhausted, codes.Aborted:
+		return true
+	default:
+		return false
+	}
+}
+
+// UnaryClientInterceptor fails calls fast while b is open. Place it before the retry
+// interceptor so an open breaker also skips the retries. Health checks bypass the
+// breaker so periodic probes don't skew the failure rate.
+func UnaryClientInterceptor(b *Breaker) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if method == healthpb.Health_Check_FullMethodName {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		done, err := b.Allow()
+		if err != nil {
+			return err
+		}
+
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		switch {
+		case ctx.Err() != nil && status.Code(err) != codes.DeadlineExceeded:
+			// A call the caller gave up on says nothing about the upstream.
+			done(Ignored)
+		case IsFailure(err):
+			done(Failure)
+		default:
+			done(Success)
+		}
+		return err
+	}
+}
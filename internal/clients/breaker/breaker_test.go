@@ -0,0 +1,152 @@
+package breaker
+
+import (
+	"cartService/internal/jsonlog"
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type clock struct{ t time.Time }
+
+func (c *clock) now() time.Time          { return c.t }
+func (c *clock) advance(d time.Duration) { c.t = c.t.Add(d) }
+
+func newTestBreaker(t *testing.T, halfOpenRequests int) (*Breaker, *clock) {
+	t.Helper()
+	c := &clock{t: time.Unix(1_700_000_000, 0)}
+	b := New(t.Name(), Config{
+		Window:           10 * time.Second,
+		MinRequests:      2,
+		FailureRate:      0.5,
+		OpenTimeout:      time.Second,
+		HalfOpenRequests: halfOpenRequests,
+	}, jsonlog.New(io.Discard, jsonlog.LevelOff))
+	b.now = c.now
+	return b, c
+}
+
+func call(t *testing.T, b *Breaker, o Outcome) {
+	t.Helper()
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	done(o)
+}
+
+// halfOpen trips b and lets OpenTimeout pass.
+func halfOpen(t *testing.T, b *Breaker, c *clock) {
+	t.Helper()
+	call(t, b, Failure)
+	call(t, b, Failure)
+	if s := b.State(); s != StateOpen {
+		t.Fatalf("state %s after failures, want open", s)
+	}
+	c.advance(time.Second)
+	if s := b.State(); s != StateHalfOpen {
+		t.Fatalf("state %s after OpenTimeout, want half-open", s)
+	}
+}
+
+func TestBreakerOpensAndRecovers(t *testing.T) {
+	b, c := newTestBreaker(t, 1)
+
+	call(t, b, Success)
+	call(t, b, Ignored)
+	call(t, b, Failure)
+	if s := b.State(); s != StateOpen {
+		t.Fatalf("state %s at a 50%% failure rate, want open", s)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrUpstreamUnavailable) {
+		t.Fatalf("Allow while open: %v, want ErrUpstreamUnavailable", err)
+	}
+
+	c.advance(time.Second)
+	call(t, b, Success)
+	if s := b.State(); s != StateClosed {
+		t.Fatalf("state %s after a successful probe, want closed", s)
+	}
+}
+
+func TestBreakerFailedProbeReopens(t *testing.T) {
+	b, c := newTestBreaker(t, 1)
+	halfOpen(t, b, c)
+
+	call(t, b, Failure)
+	if s := b.State(); s != StateOpen {
+		t.Fatalf("state %s after a failed probe, want open", s)
+	}
+}
+
+func TestBreakerIgnoredProbeFreesItsSlot(t *testing.T) {
+	b, c := newTestBreaker(t, 1)
+	halfOpen(t, b, c)
+
+	done, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	if _, err := b.Allow(); err == nil {
+		t.Fatal("second probe let through while the first one runs")
+	}
+	done(Ignored)
+
+	if s := b.State(); s != StateHalfOpen {
+		t.Fatalf("state %s after an ignored probe, want half-open", s)
+	}
+	call(t, b, Success)
+	if s := b.State(); s != StateClosed {
+		t.Fatalf("state %s after a successful probe, want closed", s)
+	}
+}
+
+func TestBreakerDropsOutcomesOfEarlierStates(t *testing.T) {
+	b, c := newTestBreaker(t, 1)
+
+	slow, err := b.Allow()
+	if err != nil {
+		t.Fatalf("Allow: %v", err)
+	}
+	halfOpen(t, b, c)
+
+	// The call started while closed must not count as the probe.
+	slow(Success)
+	if s := b.State(); s != StateHalfOpen {
+		t.Fatalf("state %s after a call from the closed state ended, want half-open", s)
+	}
+}
+
+func TestInterceptorIgnoresCancelledProbe(t *testing.T) {
+	b, c := newTestBreaker(t, 1)
+	halfOpen(t, b, c)
+	interceptor := UnaryClientInterceptor(b)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancelled := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		cancel()
+		return status.Error(codes.Canceled, "context canceled")
+	}
+	if err := interceptor(ctx, "/svc/M", nil, nil, nil, cancelled); status.Code(err) != codes.Canceled {
+		t.Fatalf("interceptor: %v, want the call's error", err)
+	}
+	if s := b.State(); s != StateHalfOpen {
+		t.Fatalf("state %s after a cancelled probe, want half-open", s)
+	}
+
+	failing := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		return status.Error(codes.Unavailable, "down")
+	}
+	if err := interceptor(context.Background(), "/svc/M", nil, nil, nil, failing); status.Code(err) != codes.Unavailable {
+		t.Fatalf("interceptor: %v, want a probe let through", err)
+	}
+	if s := b.State(); s != StateOpen {
+		t.Fatalf("state %s after a failed probe, want open", s)
+	}
+}
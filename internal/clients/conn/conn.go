@@ -0,0 +1,98 @@
+package conn
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/resolver"
+)
+
+// Config describes how a downstream client reaches its service.
+type Config struct {
+	// Target is a gRPC target string: "host:port", "dns:///host:port" to balance over
+	// every address the name resolves to, or "static:///host1:port,host2:port" for a
+	// fixed list of backends.
+	Target string `yaml:"target"`
+	// LoadBalancing is the gRPC load balancing policy (round_robin|pick_first).
+	LoadBalancing string          `yaml:"load_balancing"`
+	Keepalive     KeepaliveConfig `yaml:"keepalive"`
+	// Dialer replaces the network dialer, e.g. to reach in-process servers over a
+	// bufconn listener.
+	Dialer func(ctx context.Context, addr string) (net.Conn, error) `yaml:"-"`
+}
+
+type KeepaliveConfig struct {
+	// Time is how long a connection may be idle before it is pinged; 0 disables pings.
+	Time time.Duration `yaml:"time"`
+	// Timeout is how long to wait for a ping ack before closing the connection.
+	Timeout time.Duration `yaml:"timeout"`
+	// PermitWithoutStream sends pings even when there are no active calls.
+	PermitWithoutStream bool `yaml:"permit_without_stream"`
+}
+
+// DialOptions returns the target independent dial options of cfg.
+func DialOptions(cfg Config) ([]grpc.DialOption, error) {
+	policy := cfg.LoadBalancing
+	if policy == "" {
+		policy = "round_robin"
+	}
+	if policy != "round_robin" && policy != "pick_first" {
+		return nil, fmt.Errorf("conn.DialOptions: unknown load balancing policy %q", policy)
+	}
+
+	opts := []grpc.DialOption{
+		grpc.WithDefaultServiceConfig(fmt.Sprintf(`{"loadBalancingConfig":[{%q:{}}]}`, policy)),
+	}
+	if cfg.Keepalive.Time > 0 {
+		opts = append(opts, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.Keepalive.Time,
+			Timeout:             cfg.Keepalive.Timeout,
+			PermitWithoutStream: cfg.Keepalive.PermitWithoutStream,
+		}))
+	}
+	if cfg.Dialer != nil {
+		opts = append(opts, grpc.WithContextDialer(cfg.Dialer))
+	}
+	return opts, nil
+}
+
+const staticScheme = "static"
+
+func init() {
+	resolver.Register(staticBuilder{})
+}
+
+// staticBuilder resolves "static:///host1:port,host2:port" to the listed addresses.
+type staticBuilder struct{}
+
+func (staticBuilder) Scheme() string {
+	return staticScheme
+}
+
+func (staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	var addrs []resolver.Address
+	for _, addr := range strings.Split(target.Endpoint(), ",") {
+		if addr = strings.TrimSpace(addr); addr != "" {
+			addrs = append(addrs, resolver.Address{Addr: addr})
+		}
+	}
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("conn: static target %q lists no addresses", target.URL.String())
+	}
+
+	if err := cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		return nil, fmt.Errorf("%s: %w", "conn.staticBuilder.Build", err)
+	}
+	return staticResolver{}, nil
+}
+
+type staticResolver struct{}
+
+func (staticResolver) ResolveNow(resolver.ResolveNowOptions) {}
+
+func (staticResolver) Close() {}
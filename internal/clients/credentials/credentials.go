@@ -0,0 +1,73 @@
+package credentials
+
+import (
+	"cartService/internal/jsonlog"
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var ErrNoIncomingToken = errors.New("credentials: no bearer token in incoming metadata")
+
+// Provider returns the bearer token for an outgoing call.
+type Provider interface {
+	Token(ctx context.Context) (string, error)
+}
+
+// Forwarded passes on the caller's own token. It only works while serving a request
+// that carried one.
+type Forwarded struct{}
+
+func (Forwarded) Token(ctx context.Context) (string, error) {
+	return IncomingToken(ctx)
+}
+
+// IncomingToken returns the bearer token of the request being served.
+func IncomingToken(ctx context.Context) (string, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return "", ErrNoIncomingToken
+	}
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return "", ErrNoIncomingToken
+	}
+	return strings.TrimPrefix(values[0], "Bearer "), nil
+}
+
+// UnaryClientInterceptor sets the authorization header of every call from p,
+// replacing any header already present in the outgoing metadata. Health checks are
+// sent without credentials since they run outside of any request.
+func UnaryClientInterceptor(log *jsonlog.Logger, p Provider) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if method == healthpb.Health_Check_FullMethodName {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		token, err := p.Token(ctx)
+		if err != nil {
+			log.PrintErrorContext(ctx, err, map[string]string{
+				"method": "credentials.UnaryClientInterceptor",
+				"rpc":    method,
+			})
+			return status.Error(codes.Unauthenticated, err.Error())
+		}
+		log.PrintDebugContext(ctx, "attaching credentials", map[string]string{
+			"rpc":               method,
+			"token_fingerprint": jsonlog.Fingerprint(token),
+		})
+
+		md, _ := metadata.FromOutgoingContext(ctx)
+		md = md.Copy()
+		md.Set("authorization", "Bearer "+token)
+		ctx = metadata.NewOutgoingContext(ctx, md)
+
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
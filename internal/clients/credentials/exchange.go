@@ -0,0 +1,160 @@
+package credentials
+
+import (
+	"cartService/internal/contextkeys"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tokenExchangeGrant = "urn:ietf:params:oauth:grant-type:token-exchange"
+	accessTokenType    = "urn:ietf:params:oauth:token-type:access_token"
+)
+
+type ExchangeConfig struct {
+	// Endpoint is the OAuth 2.0 token endpoint of the authorization server.
+	Endpoint     string
+	ClientID     string
+	ClientSecret string
+	// Audience is the downstream service the exchanged token is issued for.
+	Audience string
+	Scope    string
+	Timeout  time.Duration
+	// MaxEntries bounds the number of exchanged tokens kept for reuse.
+	MaxEntries int
+}
+
+// Exchange trades the caller's token for one issued to the downstream service using
+// OAuth 2.0 Token Exchange (RFC 8693). Exchanged tokens are reused until shortly
+// before they expire, and never past the expiry of the token they were exchanged for.
+type Exchange struct {
+	cfg    ExchangeConfig
+	client *http.Client
+
+	mu    sync.Mutex
+	cache map[string]exchangedToken
+}
+
+type exchangedToken struct {
+	token     string
+	expiresAt time.Time
+}
+
+type exchangeResponse struct {
+	AccessToken string `json:"access_token"`
+	ExpiresIn   int64  `json:"expires_in"`
+}
+
+func NewExchange(cfg ExchangeConfig) *Exchange {
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = 5 * time.Second
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 10000
+	}
+	return &Exchange{
+		cfg:    cfg,
+		client: &http.Client{Timeout: cfg.Timeout},
+		cache:  make(map[string]exchangedToken),
+	}
+}
+
+func (e *Exchange) Token(ctx context.Context) (string, error) {
+	subject, err := IncomingToken(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256([]byte(subject))
+	key := hex.EncodeToString(sum[:])
+	e.mu.Lock()
+	cached, ok := e.cache[key]
+	e.mu.Unlock()
+	if ok && time.Now().Before(cached.expiresAt) {
+		return cached.token, nil
+	}
+
+	resp, err := e.exchange(ctx, subject)
+	if err != nil {
+		return "", err
+	}
+
+	lifetime := time.Duration(resp.ExpiresIn) * time.Second
+	if lifetime <= 0 {
+		lifetime = time.Minute
+	}
+	expiresAt := time.Now().Add(lifetime * 9 / 10)
+	// The caller's token was verified by the server, which put its expiry in ctx.
+	if exp, ok := ctx.Value(contextkeys.ExpiresAtKey).(time.Time); ok && exp.Before(expiresAt) {
+		expiresAt = exp
+	}
+
+	e.mu.Lock()
+	if len(e.cache) >= e.cfg.MaxEntries {
+		e.cache = make(map[string]exchangedToken)
+	}
+	e.cache[key] = exchangedToken{
+		token:     resp.AccessToken,
+		expiresAt: expiresAt,
+	}
+	e.mu.Unlock()
+
+	return resp.AccessToken, nil
+}
+
+func (e *Exchange) exchange(ctx context.Context, subject string) (*exchangeResponse, error) {
+	form := url.Values{
+		"grant_type":           {tokenExchangeGrant},
+		"subject_token":        {subject},
+		"subject_token_type":   {accessTokenType},
+		"requested_token_type": {accessTokenType},
+	}
+	if e.cfg.Audience != "" {
+		form.Set("audience", e.cfg.Audience)
+	}
+	if e.cfg.Scope != "" {
+		form.Set("scope", e.cfg.Scope)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", "credentials.Exchange", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if e.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(e.cfg.ClientID), url.QueryEscape(e.cfg.ClientSecret))
+	}
+
+	httpResp, err := e.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", "credentials.Exchange", err)
+	}
+	defer httpResp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(httpResp.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", "credentials.Exchange", err)
+	}
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("credentials.Exchange: token endpoint returned %s", httpResp.Status)
+	}
+
+	var resp exchangeResponse
+	if err := json.Unmarshal(body, &resp); err != nil {
+		return nil, fmt.Errorf("%s: %w", "credentials.Exchange", err)
+	}
+	if resp.AccessToken == "" {
+		return nil, fmt.Errorf("credentials.Exchange: token endpoint returned no access_token")
+	}
+	return &resp, nil
+}
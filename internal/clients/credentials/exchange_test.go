@@ -0,0 +1,79 @@
+package credentials
+
+import (
+	"cartService/internal/contextkeys"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/metadata"
+)
+
+// tokenEndpoint issues "exchanged-<n>" tokens valid for an hour and counts the calls.
+func tokenEndpoint(t *testing.T, calls *atomic.Int32) string {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil || r.PostForm.Get("grant_type") != tokenExchangeGrant {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		n := calls.Add(1)
+		fmt.Fprintf(w, `{"access_token":"exchanged-%d","expires_in":3600}`, n)
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL
+}
+
+func incoming(token string, exp time.Time) context.Context {
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+token))
+	if !exp.IsZero() {
+		ctx = context.WithValue(ctx, contextkeys.ExpiresAtKey, exp)
+	}
+	return ctx
+}
+
+func TestExchangeReusesTokensPerSubject(t *testing.T) {
+	var calls atomic.Int32
+	e := NewExchange(ExchangeConfig{Endpoint: tokenEndpoint(t, &calls)})
+
+	first, err := e.Token(incoming("subject-a", time.Time{}))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	again, _ := e.Token(incoming("subject-a", time.Time{}))
+	other, _ := e.Token(incoming("subject-b", time.Time{}))
+
+	if first != again {
+		t.Errorf("same subject got %q then %q, want the cached token", first, again)
+	}
+	if other == first {
+		t.Errorf("different subjects share %q", other)
+	}
+	if n := calls.Load(); n != 2 {
+		t.Errorf("%d exchanges, want 2", n)
+	}
+}
+
+func TestExchangeDoesNotOutliveSubjectToken(t *testing.T) {
+	var calls atomic.Int32
+	e := NewExchange(ExchangeConfig{Endpoint: tokenEndpoint(t, &calls)})
+
+	exp := time.Now().Add(50 * time.Millisecond)
+	first, err := e.Token(incoming("subject", exp))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	second, err := e.Token(incoming("subject", exp))
+	if err != nil {
+		t.Fatalf("Token: %v", err)
+	}
+	if second == first {
+		t.Fatalf("exchanged token %q reused after the subject token expired", first)
+	}
+}
@@ -0,0 +1,152 @@
+package credentials
+
+import (
+	"cartService/internal/contextkeys"
+	"context"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ServiceTokenConfig describes the tokens this service mints for itself.
+type ServiceTokenConfig struct {
+	Issuer   string
+	Subject  string
+	Audience string
+	KeyID    string
+	TTL      time.Duration
+}
+
+// ServiceToken mints short lived tokens signed with our own key, so calls can be made
+// outside of a user request (background jobs) or without trusting the user's token
+// downstream. When the context carries a user id it is added as "user_id", letting
+// the downstream service act on behalf of that user.
+type ServiceToken struct {
+	cfg    ServiceTokenConfig
+	method jwt.SigningMethod
+	key    any
+
+	mu        sync.Mutex
+	cached    string
+	expiresAt time.Time
+	now       func() time.Time
+}
+
+// NewServiceToken accepts an HMAC secret ([]byte), *rsa.PrivateKey or
+// *ecdsa.PrivateKey and picks HS256, RS256 or ES256 accordingly.
+func NewServiceToken(cfg ServiceTokenConfig, key any) (*ServiceToken, error) {
+	var method jwt.SigningMethod
+	switch k := key.(type) {
+	case []byte:
+		if len(k) == 0 {
+			return nil, errors.New("credentials: empty service token secret")
+		}
+		method = jwt.SigningMethodHS256
+	case *rsa.PrivateKey:
+		method = jwt.SigningMethodRS256
+	case *ecdsa.PrivateKey:
+		method = jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf("credentials: unsupported service token key %T", key)
+	}
+	if cfg.TTL <= 0 {
+		cfg.TTL = 5 * time.Minute
+	}
+
+	return &ServiceToken{
+		cfg:    cfg,
+		method: method,
+		key:    key,
+		now:    time.Now,
+	}, nil
+}
+
+func (s *ServiceToken) Token(ctx context.Context) (string, error) {
+	if userID, ok := ctx.Value(contextkeys.UserIDKey).(int64); ok {
+		return s.mint(jwt.MapClaims{"user_id": userID})
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Renew once less than a fifth of the lifetime is left so tokens never expire
+	// in flight.
+	if s.cached != "" && s.now().Before(s.expiresAt.Add(-s.cfg.TTL/5)) {
+		return s.cached, nil
+	}
+
+	token, err := s.mint(jwt.MapClaims{})
+	if err != nil {
+		return "", err
+	}
+	s.cached = token
+	s.expiresAt = s.now().Add(s.cfg.TTL)
+	return token, nil
+}
+
+func (s *ServiceToken) mint(claims jwt.MapClaims) (string, error) {
+	now := s.now()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(s.cfg.TTL).Unix()
+	if s.cfg.Issuer != "" {
+		claims["iss"] = s.cfg.Issuer
+	}
+	if s.cfg.Subject != "" {
+		claims["sub"] = s.cfg.Subject
+	}
+	if s.cfg.Audience != "" {
+		claims["aud"] = s.cfg.Audience
+	}
+
+	token := jwt.NewWithClaims(s.method, claims)
+	if s.cfg.KeyID != "" {
+		token.Header["kid"] = s.cfg.KeyID
+	}
+
+	signed, err := token.SignedString(s.key)
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", "credentials.ServiceToken.mint", err)
+	}
+	return signed, nil
+}
+
+// LoadPrivateKey reads a PEM encoded RSA or EC private key (PKCS#1, SEC 1 or PKCS#8).
+func LoadPrivateKey(path string) (any, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", "credentials.LoadPrivateKey", err)
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("credentials.LoadPrivateKey: %s: no PEM data", path)
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		return x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", "credentials.LoadPrivateKey", err)
+		}
+		switch key.(type) {
+		case *rsa.PrivateKey, *ecdsa.PrivateKey:
+			return key, nil
+		default:
+			return nil, fmt.Errorf("credentials.LoadPrivateKey: unsupported key type %T", key)
+		}
+	default:
+		return nil, fmt.Errorf("credentials.LoadPrivateKey: unsupported PEM block %q", block.Type)
+	}
+}
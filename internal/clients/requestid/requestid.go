@@ -0,0 +1,24 @@
+// Package requestid hands the request id of the call being served on to downstream
+// services.
+package requestid
+
+import (
+	"cartService/internal/contextkeys"
+	"context"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Header carries the request id in gRPC metadata.
+const Header = "x-request-id"
+
+// UnaryClientInterceptor sends the request id stored in ctx, if any, in Header.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if id, ok := ctx.Value(contextkeys.RequestIDKey).(string); ok && id != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, Header, id)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
@@ -0,0 +1,250 @@
+package retry
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Policy describes how one method is retried.
+type Policy struct {
+	// MaxAttempts counts the first call too; 1 disables retries.
+	MaxAttempts int `yaml:"max_attempts"`
+	// Codes lists the status codes worth retrying, e.g. UNAVAILABLE.
+	Codes []string `yaml:"codes"`
+	// InitialBackoff is the wait before the first retry; every further retry waits
+	// Multiplier times longer, up to MaxBackoff.
+	InitialBackoff time.Duration `yaml:"initial_backoff"`
+	MaxBackoff     time.Duration `yaml:"max_backoff"`
+	Multiplier     float64       `yaml:"multiplier"`
+	// Jitter spreads each wait uniformly over ±Jitter of its length, in [0, 1].
+	Jitter float64 `yaml:"jitter"`
+	// PerAttemptTimeout bounds every attempt; 0 leaves only the caller's deadline.
+	PerAttemptTimeout time.Duration `yaml:"per_attempt_timeout"`
+	// Budget bounds the whole call, all attempts and waits included.
+	Budget time.Duration `yaml:"budget"`
+	// HedgeDelay, when set, sends another attempt whenever the previous ones have not
+	// answered within HedgeDelay, up to MaxAttempts in flight, and takes the first
+	// answer. Only use it for idempotent reads.
+	HedgeDelay time.Duration `yaml:"hedge_delay"`
+}
+
+// Config maps full method names ("/toys.Toys/GetToy") to their policy. Methods not
+// listed use Default.
+type Config struct {
+	Default Policy            `yaml:"default"`
+	Methods map[string]Policy `yaml:"methods"`
+}
+
+func (c Config) policy(method string) Policy {
+	if p, ok := c.Methods[method]; ok {
+		return p
+	}
+	return c.Default
+}
+
+// DefaultCodes are safe to retry for any call: the request never reached the service
+// or the attempt ran out of time.
+var DefaultCodes = []string{"UNAVAILABLE", "DEADLINE_EXCEEDED"}
+
+type compiled struct {
+	Policy
+	retryable map[codes.Code]bool
+}
+
+func compile(p Policy) (compiled, error) {
+	if p.MaxAttempts <= 0 {
+		p.MaxAttempts = 1
+	}
+	if p.Multiplier < 1 {
+		p.Multiplier = 2
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = 50 * time.Millisecond
+	}
+	if p.MaxBackoff < p.InitialBackoff {
+		p.MaxBackoff = p.InitialBackoff
+	}
+	if p.Jitter < 0 || p.Jitter > 1 {
+		return compiled{}, fmt.Errorf("retry: jitter %v is not in [0, 1]", p.Jitter)
+	}
+
+	names := p.Codes
+	if len(names) == 0 {
+		names = DefaultCodes
+	}
+	retryable := make(map[codes.Code]bool, len(names))
+	for _, name := range names {
+		var code codes.Code
+		if err := code.UnmarshalJSON([]byte(`"` + strings.ToUpper(strings.TrimSpace(name)) + `"`)); err != nil {
+			return compiled{}, fmt.Errorf("retry: unknown status code %q", name)
+		}
+		if code == codes.NotFound || code == codes.InvalidArgument || code == codes.PermissionDenied || code == codes.Unauthenticated {
+			return compiled{}, fmt.Errorf("retry: %s never succeeds on retry", name)
+		}
+		retryable[code] = true
+	}
+
+	return compiled{Policy: p, retryable: retryable}, nil
+}
+
+// backoff returns the wait before retry n (1 for the first retry).
+func (p compiled) backoff(n int) time.Duration {
+	d := float64(p.InitialBackoff) * math.Pow(p.Multiplier, float64(n-1))
+	if d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d *= 1 + p.Jitter*(2*rand.Float64()-1)
+	}
+	return time.Duration(d)
+}
+
+// UnaryClientInterceptor retries or hedges calls according to cfg. It fails at
+// creation for invalid policies so bad config is caught at startup.
+func UnaryClientInterceptor(cfg Config) (grpc.UnaryClientInterceptor, error) {
+	def, err := compile(cfg.Default)
+	if err != nil {
+		return nil, err
+	}
+	methods := make(map[string]compiled, len(cfg.Methods))
+	for m, p := range cfg.Methods {
+		c, err := compile(p)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", m, err)
+		}
+		methods[m] = c
+	}
+
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		p, ok := methods[method]
+		if !ok {
+			p = def
+		}
+
+		if p.Budget > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, p.Budget)
+			defer cancel()
+		}
+
+		if p.HedgeDelay > 0 && p.MaxAttempts > 1 {
+			return hedge(ctx, p, method, req, reply, cc, invoker, opts)
+		}
+		return retry(ctx, p, method, req, reply, cc, invoker, opts)
+	}, nil
+}
+
+func attempt(ctx context.Context, p compiled, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts []grpc.CallOption) error {
+	if p.PerAttemptTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, p.PerAttemptTimeout)
+		defer cancel()
+	}
+	return invoker(ctx, method, req, reply, cc, opts...)
+}
+
+func retry(ctx context.Context, p compiled, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts []grpc.CallOption) error {
+	var err error
+	for n := 0; n < p.MaxAttempts; n++ {
+		if n > 0 {
+			wait := p.backoff(n)
+			// Don't start a wait the budget can't cover.
+			if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+				return err
+			}
+			timer := time.NewTimer(wait)
+			select {
+			case <-ctx.Done():
+				timer.Stop()
+				return err
+			case <-timer.C:
+			}
+		}
+
+		err = attempt(ctx, p, method, req, reply, cc, invoker, opts)
+		if err == nil || !p.retryable[status.Code(err)] || ctx.Err() != nil {
+			return err
+		}
+	}
+	return err
+}
+
+type hedgeResult struct {
+	reply interface{}
+	err   error
+}
+
+// hedge sends up to MaxAttempts copies of the call HedgeDelay apart and returns the
+// first success or non-retryable error; the other attempts are cancelled. A failed
+// attempt is replaced no sooner than a retry would be, after backoff.
+func hedge(ctx context.Context, p compiled, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts []grpc.CallOption) error {
+	msg, ok := reply.(proto.Message)
+	if !ok {
+		return retry(ctx, p, method, req, reply, cc, invoker, opts)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	results := make(chan hedgeResult, p.MaxAttempts)
+	launch := func() {
+		r := msg.ProtoReflect().New().Interface()
+		go func() {
+			results <- hedgeResult{reply: r, err: attempt(ctx, p, method, req, r, cc, invoker, opts)}
+		}()
+	}
+
+	launch()
+	sent, pending := 1, 1
+	timer := time.NewTimer(p.HedgeDelay)
+	defer timer.Stop()
+
+	var lastErr error
+	limit := p.MaxAttempts
+	for pending > 0 || sent < limit {
+		select {
+		case <-ctx.Done():
+			if lastErr != nil {
+				return lastErr
+			}
+			return status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+			if sent < limit {
+				launch()
+				sent++
+				pending++
+				timer.Reset(p.HedgeDelay)
+			}
+		case res := <-results:
+			pending--
+			if res.err == nil {
+				proto.Reset(msg)
+				proto.Merge(msg, res.reply.(proto.Message))
+				return nil
+			}
+			lastErr = res.err
+			if !p.retryable[status.Code(res.err)] {
+				return res.err
+			}
+			if sent < limit {
+				wait := p.backoff(sent)
+				// Don't start a wait the budget can't cover.
+				if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < wait {
+					limit = sent
+					continue
+				}
+				timer.Reset(wait)
+			}
+		}
+	}
+	return lastErr
+}
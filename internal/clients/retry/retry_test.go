@@ -0,0 +1,201 @@
+package retry
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+// fakeInvoker answers the nth attempt (from 0) with answer(n, ctx) and records when
+// every attempt started.
+type fakeInvoker struct {
+	answer func(ctx context.Context, n int, reply *wrapperspb.StringValue) error
+
+	mu     sync.Mutex
+	starts []time.Time
+}
+
+func (f *fakeInvoker) invoke(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+	f.mu.Lock()
+	n := len(f.starts)
+	f.starts = append(f.starts, time.Now())
+	f.mu.Unlock()
+	return f.answer(ctx, n, reply.(*wrapperspb.StringValue))
+}
+
+func (f *fakeInvoker) calls() []time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return append([]time.Time(nil), f.starts...)
+}
+
+func call(t *testing.T, p Policy, f *fakeInvoker) (*wrapperspb.StringValue, error) {
+	t.Helper()
+	interceptor, err := UnaryClientInterceptor(Config{Default: p})
+	if err != nil {
+		t.Fatalf("UnaryClientInterceptor: %v", err)
+	}
+	reply := &wrapperspb.StringValue{}
+	err = interceptor(context.Background(), "/svc/M", &wrapperspb.StringValue{}, reply, nil, f.invoke)
+	return reply, err
+}
+
+func unavailable(ctx context.Context, n int, reply *wrapperspb.StringValue) error {
+	return status.Error(codes.Unavailable, "down")
+}
+
+func TestCompile(t *testing.T) {
+	tests := []struct {
+		name   string
+		policy Policy
+		want   string
+	}{
+		{"not found", Policy{Codes: []string{"UNAVAILABLE", "NOT_FOUND"}}, "never succeeds on retry"},
+		{"invalid argument", Policy{Codes: []string{"invalid_argument"}}, "never succeeds on retry"},
+		{"permission denied", Policy{Codes: []string{"PERMISSION_DENIED"}}, "never succeeds on retry"},
+		{"unauthenticated", Policy{Codes: []string{"UNAUTHENTICATED"}}, "never succeeds on retry"},
+		{"unknown code", Policy{Codes: []string{"GONE"}}, "unknown status code"},
+		{"negative jitter", Policy{Jitter: -0.1}, "jitter"},
+		{"jitter above one", Policy{Jitter: 1.5}, "jitter"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := compile(tt.policy); err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("compile = %v, want an error containing %q", err, tt.want)
+			}
+		})
+	}
+
+	p, err := compile(Policy{Codes: []string{" resource_exhausted "}})
+	if err != nil {
+		t.Fatalf("compile: %v", err)
+	}
+	if !p.retryable[codes.ResourceExhausted] || p.retryable[codes.Unavailable] {
+		t.Errorf("retryable = %v, want only RESOURCE_EXHAUSTED", p.retryable)
+	}
+	if p.MaxAttempts != 1 || p.Multiplier != 2 || p.InitialBackoff != 50*time.Millisecond || p.MaxBackoff != p.InitialBackoff {
+		t.Errorf("defaults = %+v", p.Policy)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	p, err := compile(Policy{InitialBackoff: 10 * time.Millisecond, MaxBackoff: 50 * time.Millisecond, Multiplier: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for n, want := range []time.Duration{10, 20, 40, 50, 50} {
+		if got := p.backoff(n + 1); got != want*time.Millisecond {
+			t.Errorf("backoff(%d) = %s, want %s", n+1, got, want*time.Millisecond)
+		}
+	}
+
+	p.Jitter = 0.5
+	for range 100 {
+		if got := p.backoff(4); got < 25*time.Millisecond || got > 75*time.Millisecond {
+			t.Fatalf("backoff with jitter = %s, want within 50ms ± 50%%", got)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	f := &fakeInvoker{answer: func(ctx context.Context, n int, reply *wrapperspb.StringValue) error {
+		if n < 2 {
+			return status.Error(codes.Unavailable, "down")
+		}
+		reply.Value = "ok"
+		return nil
+	}}
+	reply, err := call(t, Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, f)
+	if err != nil || reply.Value != "ok" {
+		t.Fatalf("call = %v, %v, want the third attempt's reply", reply, err)
+	}
+
+	f = &fakeInvoker{answer: func(ctx context.Context, n int, reply *wrapperspb.StringValue) error {
+		return status.Error(codes.Internal, "broken")
+	}}
+	if _, err := call(t, Policy{MaxAttempts: 3, InitialBackoff: time.Millisecond}, f); status.Code(err) != codes.Internal || len(f.calls()) != 1 {
+		t.Fatalf("call = %v after %d attempts, want Internal after one", err, len(f.calls()))
+	}
+}
+
+func TestRetrySkipsWaitBeyondBudget(t *testing.T) {
+	f := &fakeInvoker{answer: unavailable}
+	start := time.Now()
+	_, err := call(t, Policy{MaxAttempts: 3, InitialBackoff: time.Second, Budget: 100 * time.Millisecond}, f)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("call = %v, want the attempt's error", err)
+	}
+	if n := len(f.calls()); n != 1 {
+		t.Fatalf("%d attempts, want one", n)
+	}
+	if elapsed := time.Since(start); elapsed > 50*time.Millisecond {
+		t.Fatalf("call took %s, want it to give up without waiting", elapsed)
+	}
+}
+
+func TestHedgeReturnsFirstSuccess(t *testing.T) {
+	firstCancelled := make(chan error, 1)
+	f := &fakeInvoker{answer: func(ctx context.Context, n int, reply *wrapperspb.StringValue) error {
+		if n == 0 {
+			<-ctx.Done()
+			firstCancelled <- ctx.Err()
+			return status.FromContextError(ctx.Err()).Err()
+		}
+		reply.Value = "hedged"
+		return nil
+	}}
+
+	reply, err := call(t, Policy{MaxAttempts: 3, HedgeDelay: 10 * time.Millisecond}, f)
+	if err != nil || reply.Value != "hedged" {
+		t.Fatalf("call = %v, %v, want the hedged attempt's reply", reply, err)
+	}
+	select {
+	case err := <-firstCancelled:
+		if !errors.Is(err, context.Canceled) {
+			t.Fatalf("slow attempt ended with %v, want it cancelled", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("slow attempt not cancelled")
+	}
+	if n := len(f.calls()); n != 2 {
+		t.Fatalf("%d attempts, want two", n)
+	}
+}
+
+func TestHedgeBacksOffAfterFailure(t *testing.T) {
+	f := &fakeInvoker{answer: func(ctx context.Context, n int, reply *wrapperspb.StringValue) error {
+		if n == 0 {
+			return status.Error(codes.Unavailable, "down")
+		}
+		reply.Value = "ok"
+		return nil
+	}}
+
+	reply, err := call(t, Policy{MaxAttempts: 2, HedgeDelay: time.Hour, InitialBackoff: 50 * time.Millisecond}, f)
+	if err != nil || reply.Value != "ok" {
+		t.Fatalf("call = %v, %v, want the second attempt's reply", reply, err)
+	}
+	calls := f.calls()
+	if gap := calls[1].Sub(calls[0]); gap < 50*time.Millisecond {
+		t.Fatalf("failed attempt replaced after %s, want at least the 50ms backoff", gap)
+	}
+}
+
+func TestHedgeSkipsWaitBeyondBudget(t *testing.T) {
+	f := &fakeInvoker{answer: unavailable}
+	_, err := call(t, Policy{MaxAttempts: 3, HedgeDelay: time.Hour, InitialBackoff: time.Second, Budget: 100 * time.Millisecond}, f)
+	if status.Code(err) != codes.Unavailable {
+		t.Fatalf("call = %v, want the attempt's error", err)
+	}
+	if n := len(f.calls()); n != 1 {
+		t.Fatalf("%d attempts, want one", n)
+	}
+}
@@ -0,0 +1,172 @@
+package grpc
+
+import (
+	"context"
+	"expvar"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	subs "github.com/spacecowboytobykty123/subsProto/gen/go/subscription"
+	"golang.org/x/sync/singleflight"
+)
+
+// CacheConfig controls caching of CheckSubscription results per user. A zero TTL
+// disables caching of the corresponding kind of answer.
+type CacheConfig struct {
+	// TTL is how long a "subscribed" answer is trusted.
+	TTL time.Duration
+	// NegativeTTL is how long a "not subscribed" answer is trusted. Keep it short so
+	// users who just subscribed are not locked out for long.
+	NegativeTTL time.Duration
+	// MaxEntries bounds the cache size; when it is reached expired entries are purged
+	// and, if that is not enough, the cache is reset.
+	MaxEntries int
+}
+
+// fetchTimeout bounds a subscriptions service call shared by every caller waiting on
+// the same user, since it does not run under any one caller's deadline.
+const fetchTimeout = 5 * time.Second
+
+var (
+	cacheStats = expvar.NewMap("subs_cache")
+
+	cacheHits    = new(expvar.Int)
+	cacheMisses  = new(expvar.Int)
+	cacheShared  = new(expvar.Int)
+	cacheEntries = new(expvar.Int)
+)
+
+func init() {
+	cacheStats.Set("hits", cacheHits)
+	cacheStats.Set("misses", cacheMisses)
+	cacheStats.Set("shared", cacheShared)
+	cacheStats.Set("entries", cacheEntries)
+	cacheStats.Set("hit_ratio", expvar.Func(func() any {
+		hits, misses := cacheHits.Value(), cacheMisses.Value()
+		if hits+misses == 0 {
+			return 0.0
+		}
+		return float64(hits) / float64(hits+misses)
+	}))
+}
+
+type statusCache struct {
+	cfg   CacheConfig
+	group singleflight.Group
+
+	mu      sync.Mutex
+	entries map[int64]cacheEntry
+}
+
+type cacheEntry struct {
+	status    subs.Status
+	expiresAt time.Time
+}
+
+func newStatusCache(cfg CacheConfig) *statusCache {
+	if cfg.TTL <= 0 && cfg.NegativeTTL <= 0 {
+		return nil
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 100000
+	}
+	return &statusCache{
+		cfg:     cfg,
+		entries: make(map[int64]cacheEntry),
+	}
+}
+
+// check returns the cached status for userID, calling fetch on a miss. Concurrent
+// misses for the same user share a single fetch, detached from ctx so that one caller
+// giving up does not fail the others; ctx only bounds how long this caller waits.
+func (c *statusCache) check(ctx context.Context, userID int64, fetch func(ctx context.Context) (*subs.CheckSubsResponse, error)) (*subs.CheckSubsResponse, error) {
+	if st, ok := c.get(userID); ok {
+		cacheHits.Add(1)
+		cacheRequests.WithLabelValues("hit").Inc()
+		return &subs.CheckSubsResponse{SubStatus: st}, nil
+	}
+	cacheMisses.Add(1)
+	cacheRequests.WithLabelValues("miss").Inc()
+
+	ch := c.group.DoChan(strconv.FormatInt(userID, 10), func() (any, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+		defer cancel()
+
+		resp, err := fetch(fetchCtx)
+		if err != nil {
+			return resp.GetSubStatus(), err
+		}
+		c.put(userID, resp.GetSubStatus())
+		return resp.GetSubStatus(), nil
+	})
+
+	select {
+	case res := <-ch:
+		if res.Shared {
+			cacheShared.Add(1)
+		}
+		return &subs.CheckSubsResponse{SubStatus: res.Val.(subs.Status)}, res.Err
+	case <-ctx.Done():
+		return &subs.CheckSubsResponse{SubStatus: subs.Status_STATUS_INTERNAL_ERROR}, fmt.Errorf("%s: %w", "grpc.CheckSubscription", context.Cause(ctx))
+	}
+}
+
+func (c *statusCache) get(userID int64) (subs.Status, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[userID]
+	if !ok {
+		return 0, false
+	}
+	if time.Now().After(e.expiresAt) {
+		delete(c.entries, userID)
+		cacheEntries.Add(-1)
+		return 0, false
+	}
+	return e.status, true
+}
+
+func (c *statusCache) put(userID int64, st subs.Status) {
+	var ttl time.Duration
+	switch st {
+	case subs.Status_STATUS_SUBSCRIBED:
+		ttl = c.cfg.TTL
+	case subs.Status_STATUS_NOT_SUBSCRIBED, subs.Status_STATUS_SUBSCRIPTION_NOTFOUND:
+		ttl = c.cfg.NegativeTTL
+	}
+	// Errors and unknown answers are never cached.
+	if ttl <= 0 {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, exist := c.entries[userID]; !exist {
+		if len(c.entries) >= c.cfg.MaxEntries {
+			c.evictLocked()
+		}
+		cacheEntries.Add(1)
+	}
+	c.entries[userID] = cacheEntry{
+		status:    st,
+		expiresAt: time.Now().Add(ttl),
+	}
+}
+
+func (c *statusCache) evictLocked() {
+	now := time.Now()
+	for id, e := range c.entries {
+		if now.After(e.expiresAt) {
+			delete(c.entries, id)
+			cacheEntries.Add(-1)
+		}
+	}
+	if len(c.entries) >= c.cfg.MaxEntries {
+		cacheEntries.Add(-int64(len(c.entries)))
+		c.entries = make(map[int64]cacheEntry)
+	}
+}
@@ -0,0 +1,108 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	subs "github.com/spacecowboytobykty123/subsProto/gen/go/subscription"
+)
+
+func TestStatusCacheFetchOutlivesCancelledCaller(t *testing.T) {
+	c := newStatusCache(CacheConfig{TTL: time.Minute})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fetchErr := make(chan error, 1)
+	fetch := func(ctx context.Context) (*subs.CheckSubsResponse, error) {
+		close(started)
+		<-release
+		fetchErr <- ctx.Err()
+		return &subs.CheckSubsResponse{SubStatus: subs.Status_STATUS_SUBSCRIBED}, nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.check(ctx, 1, fetch)
+		done <- err
+	}()
+
+	<-started
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller got %v, want context.Canceled", err)
+	}
+
+	close(release)
+	if err := <-fetchErr; err != nil {
+		t.Fatalf("shared fetch saw %v after its caller left", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for {
+		if st, ok := c.get(1); ok && st == subs.Status_STATUS_SUBSCRIBED {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("result of the shared fetch was not cached")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestStatusCacheSharesConcurrentMisses(t *testing.T) {
+	c := newStatusCache(CacheConfig{TTL: time.Minute})
+
+	release := make(chan struct{})
+	calls := make(chan struct{}, 10)
+	fetch := func(ctx context.Context) (*subs.CheckSubsResponse, error) {
+		calls <- struct{}{}
+		<-release
+		return &subs.CheckSubsResponse{SubStatus: subs.Status_STATUS_SUBSCRIBED}, nil
+	}
+
+	results := make(chan subs.Status, 2)
+	for range 2 {
+		go func() {
+			resp, _ := c.check(context.Background(), 1, fetch)
+			results <- resp.GetSubStatus()
+		}()
+	}
+	<-calls
+	// Give the second caller time to join the flight before it ends.
+	time.Sleep(20 * time.Millisecond)
+	close(release)
+
+	for range 2 {
+		if st := <-results; st != subs.Status_STATUS_SUBSCRIBED {
+			t.Fatalf("caller got %s", st)
+		}
+	}
+	if n := len(calls); n != 0 {
+		t.Fatalf("%d extra fetches, want the misses shared", n)
+	}
+}
+
+func TestStatusCacheCountsHitsAndMisses(t *testing.T) {
+	c := newStatusCache(CacheConfig{TTL: time.Minute})
+	fetch := func(ctx context.Context) (*subs.CheckSubsResponse, error) {
+		return &subs.CheckSubsResponse{SubStatus: subs.Status_STATUS_SUBSCRIBED}, nil
+	}
+	hits := testutil.ToFloat64(cacheRequests.WithLabelValues("hit"))
+	misses := testutil.ToFloat64(cacheRequests.WithLabelValues("miss"))
+
+	for range 3 {
+		if _, err := c.check(context.Background(), 1, fetch); err != nil {
+			t.Fatalf("check: %v", err)
+		}
+	}
+
+	if got := testutil.ToFloat64(cacheRequests.WithLabelValues("miss")) - misses; got != 1 {
+		t.Errorf("%v misses counted, want 1", got)
+	}
+	if got := testutil.ToFloat64(cacheRequests.WithLabelValues("hit")) - hits; got != 2 {
+		t.Errorf("%v hits counted, want 2", got)
+	}
+}
@@ -1,98 +1,138 @@
 package grpc
 
 import (
+	"cartService/internal/clients/breaker"
+	"cartService/internal/clients/conn"
+	"cartService/internal/clients/credentials"
+	"cartService/internal/clients/requestid"
+	"cartService/internal/clients/retry"
 	"cartService/internal/jsonlog"
+	"cartService/internal/tracing"
 	"context"
+	"crypto/tls"
 	"fmt"
 	grpclog "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
-	grpcretry "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/retry"
 	subs "github.com/spacecowboytobykty123/subsProto/gen/go/subscription"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	grpccreds "google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/metadata"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
 	"time"
 )
 
 type Client struct {
-	subApi subs.SubscriptionClient
-	log    *jsonlog.Logger
+	subApi    subs.SubscriptionClient
+	healthApi healthpb.HealthClient
+	log       *jsonlog.Logger
+	cache     *statusCache
+	known     *lastKnownGood
 }
 
-func New(ctx context.Context, log *jsonlog.Logger, addr int, timeout time.Duration, retriesCount int) (*Client, error) {
+func New(ctx context.Context, log *jsonlog.Logger, connCfg conn.Config, retryCfg retry.Config, cacheCfg CacheConfig, creds credentials.Provider, tlsCfg *tls.Config, cb *breaker.Breaker) (*Client, error) {
 
-	retryOpts := []grpcretry.CallOption{
-		grpcretry.WithCodes(codes.NotFound, codes.Aborted, codes.DeadlineExceeded),
-		grpcretry.WithMax(uint(retriesCount)),
-		grpcretry.WithPerRetryTimeout(timeout),
+	retryInterceptor, err := retry.UnaryClientInterceptor(retryCfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", "grpc.New", err)
 	}
 
 	logOpts := []grpclog.Option{
 		grpclog.WithLogOnEvents(grpclog.PayloadReceived, grpclog.PayloadReceived),
 	}
 
-	cc, err := grpc.DialContext(ctx, "localhost:3000",
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithChainUnaryInterceptor(
-			grpclog.UnaryClientInterceptor(InterceptorLogger(log), logOpts...),
-			grpcretry.UnaryClientInterceptor(retryOpts...),
-			// NewJWTUnaryInterceptor("dadasdaw2"),
-		),
+	// A nil tlsCfg keeps the connection in plaintext.
+	transport := insecure.NewCredentials()
+	if tlsCfg != nil {
+		transport = grpccreds.NewTLS(tlsCfg)
+	}
+
+	dialOpts, err := conn.DialOptions(connCfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", "grpc.New", err)
+	}
+	// The breaker wraps the retries so an open breaker fails the call at once.
+	interceptors := []grpc.UnaryClientInterceptor{
+		grpclog.UnaryClientInterceptor(jsonlog.InterceptorLogger(log), logOpts...),
+	}
+	if cb != nil {
+		interceptors = append(interceptors, breaker.UnaryClientInterceptor(cb))
+	}
+	interceptors = append(interceptors,
+		retryInterceptor,
+		requestid.UnaryClientInterceptor(),
+		credentials.UnaryClientInterceptor(log, creds),
+	)
+
+	dialOpts = append(dialOpts,
+		grpc.WithTransportCredentials(transport),
+		grpc.WithStatsHandler(tracing.ClientHandler()),
+		grpc.WithChainUnaryInterceptor(interceptors...),
 	)
 
+	cc, err := grpc.DialContext(ctx, connCfg.Target, dialOpts...)
+
 	if err != nil {
 		return nil, fmt.Errorf("%s:%w", "grpc.New", err)
 	}
 	return &Client{
-		subApi: subs.NewSubscriptionClient(cc),
-		log:    log,
+		subApi:    subs.NewSubscriptionClient(cc),
+		healthApi: healthpb.NewHealthClient(cc),
+		log:       log,
+		cache:     newStatusCache(cacheCfg),
+		known:     newLastKnownGood(cacheCfg.MaxEntries),
 	}, nil
 }
 
-func InterceptorLogger(logger *jsonlog.Logger) grpclog.Logger {
-	return grpclog.LoggerFunc(func(ctx context.Context, lvl grpclog.Level, msg string, fields ...any) {
-		logger.PrintInfo(msg, map[string]string{
-			"lvl": string(lvl),
-		})
-	},
-	)
+// CheckSubscription always returns a response; when the subscriptions service could
+// not be asked its status is STATUS_INTERNAL_ERROR and err says why, e.g. a
+// *breaker.UnavailableError while the circuit breaker is open.
+func (c *Client) CheckSubscription(ctx context.Context, userID int64) (*subs.CheckSubsResponse, error) {
+	if c.cache == nil {
+		return c.checkSubscription(ctx, userID)
+	}
+	return c.cache.check(ctx, userID, func(ctx context.Context) (*subs.CheckSubsResponse, error) {
+		return c.checkSubscription(ctx, userID)
+	})
 }
 
-func (c *Client) CheckSubscription(ctx context.Context, userID int64) *subs.CheckSubsResponse {
-	c.log.PrintInfo("checking subscription", map[string]string{
+func (c *Client) checkSubscription(ctx context.Context, userID int64) (*subs.CheckSubsResponse, error) {
+	c.log.PrintInfoContext(ctx, "checking subscription", map[string]string{
 		"method": "grpc.CheckSubscription",
 	})
 
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		c.log.PrintError(fmt.Errorf("missing metadata"), nil)
-		return &subs.CheckSubsResponse{SubStatus: subs.Status_STATUS_INTERNAL_ERROR}
+	start := time.Now()
+	resp, err := c.subApi.CheckSubscription(ctx, &subs.CheckSubsRequest{})
+	checkDuration.WithLabelValues(status.Code(err).String()).Observe(time.Since(start).Seconds())
+	if err != nil {
+		c.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "grpc.CheckSubscription",
+		})
+		return &subs.CheckSubsResponse{SubStatus: subs.Status_STATUS_INTERNAL_ERROR}, fmt.Errorf("%s: %w", "grpc.CheckSubscription", err)
 	}
 
-	authHeader := md.Get("authorization")
-	if len(authHeader) == 0 {
-		c.log.PrintError(fmt.Errorf("missing authorization token"), nil)
-		return &subs.CheckSubsResponse{SubStatus: subs.Status_STATUS_INTERNAL_ERROR}
-	}
+	c.known.observe(userID, resp.GetSubStatus())
+	return resp, nil
+}
 
-	outCtx := metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", authHeader[0]))
-	c.log.PrintInfo("forwarding JWT token", map[string]string{
-		"token": authHeader[0],
-	})
+// LastSubscribed returns when the subscriptions service last confirmed userID as
+// subscribed. It is forgotten as soon as the service answers otherwise.
+func (c *Client) LastSubscribed(userID int64) (time.Time, bool) {
+	return c.known.get(userID)
+}
 
-	resp, err := c.subApi.CheckSubscription(outCtx, &subs.CheckSubsRequest{})
+// Health asks the service's grpc.health.v1 endpoint whether it is serving. Services
+// that don't implement the health service count as healthy once they answer.
+func (c *Client) Health(ctx context.Context) error {
+	resp, err := c.healthApi.Check(ctx, &healthpb.HealthCheckRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
 	if err != nil {
-		println(err.Error())
-		return &subs.CheckSubsResponse{SubStatus: subs.Status_STATUS_INTERNAL_ERROR}
+		return fmt.Errorf("%s: %w", "grpc.Health", err)
 	}
-
-	return resp
-}
-
-func NewJWTUnaryInterceptor(token string) grpc.UnaryClientInterceptor {
-	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
-		md := metadata.Pairs("authorization", "Bearer "+token)
-		ctx = metadata.NewOutgoingContext(ctx, md)
-		return invoker(ctx, method, req, reply, cc, opts...)
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("grpc.Health: service is %s", resp.GetStatus())
 	}
+	return nil
 }
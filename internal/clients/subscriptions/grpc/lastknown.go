@@ -0,0 +1,49 @@
+package grpc
+
+import (
+	"sync"
+	"time"
+
+	subs "github.com/spacecowboytobykty123/subsProto/gen/go/subscription"
+)
+
+// lastKnownGood remembers when each user was last seen subscribed, independently of
+// the status cache, so callers can decide how long to trust that answer while the
+// subscriptions service is failing.
+type lastKnownGood struct {
+	mu   sync.Mutex
+	seen map[int64]time.Time
+	max  int
+}
+
+func newLastKnownGood(max int) *lastKnownGood {
+	if max <= 0 {
+		max = 100000
+	}
+	return &lastKnownGood{
+		seen: make(map[int64]time.Time),
+		max:  max,
+	}
+}
+
+func (l *lastKnownGood) observe(userID int64, st subs.Status) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	switch st {
+	case subs.Status_STATUS_SUBSCRIBED:
+		if _, ok := l.seen[userID]; !ok && len(l.seen) >= l.max {
+			l.seen = make(map[int64]time.Time)
+		}
+		l.seen[userID] = time.Now()
+	case subs.Status_STATUS_NOT_SUBSCRIBED, subs.Status_STATUS_SUBSCRIPTION_NOTFOUND:
+		delete(l.seen, userID)
+	}
+}
+
+func (l *lastKnownGood) get(userID int64) (time.Time, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	at, ok := l.seen[userID]
+	return at, ok
+}
@@ -0,0 +1,223 @@
+package grpc
+
+import (
+	"cartService/internal/clients/breaker"
+	"container/list"
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/spacecowboytobykty123/toysProto/gen/go/toys"
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// CacheConfig controls the GetToy metadata cache. A zero TTL disables it.
+type CacheConfig struct {
+	// TTL is how long a toy is served without asking the toys service again.
+	TTL time.Duration
+	// StaleTTL is how long after TTL an entry may still be served while it is
+	// refreshed in the background.
+	StaleTTL time.Duration
+	// MaxAge is how long an entry is kept at all. Past TTL+StaleTTL it is only served
+	// when fetching a fresh copy fails. It is never shorter than TTL+StaleTTL.
+	MaxAge time.Duration
+	// MaxEntries bounds the cache; the least recently used toys are evicted first.
+	MaxEntries int
+	// BatchConcurrency caps the number of concurrent GetToy calls made by GetToys.
+	BatchConcurrency int
+}
+
+// fetchTimeout bounds a toys service call shared by every caller waiting on the same
+// toy, since it does not run under any one caller's deadline.
+const fetchTimeout = 5 * time.Second
+
+var (
+	cacheStats = expvar.NewMap("toys_cache")
+
+	cacheHits      = new(expvar.Int)
+	cacheStaleHits = new(expvar.Int)
+	cacheMisses    = new(expvar.Int)
+	cacheShared    = new(expvar.Int)
+)
+
+func init() {
+	cacheStats.Set("hits", cacheHits)
+	cacheStats.Set("stale_hits", cacheStaleHits)
+	cacheStats.Set("misses", cacheMisses)
+	cacheStats.Set("shared", cacheShared)
+	cacheStats.Set("hit_ratio", expvar.Func(func() any {
+		hits := cacheHits.Value() + cacheStaleHits.Value()
+		misses := cacheMisses.Value()
+		if hits+misses == 0 {
+			return 0.0
+		}
+		return float64(hits) / float64(hits+misses)
+	}))
+}
+
+type toyCache struct {
+	cfg   CacheConfig
+	group singleflight.Group
+
+	mu    sync.Mutex
+	ll    *list.List
+	items map[int64]*list.Element
+}
+
+type toyEntry struct {
+	toyID     int64
+	resp      *toys.GetToyResponse
+	fetchedAt time.Time
+}
+
+func newToyCache(cfg CacheConfig) *toyCache {
+	if cfg.TTL <= 0 {
+		return nil
+	}
+	if cfg.MaxEntries <= 0 {
+		cfg.MaxEntries = 10000
+	}
+	if cfg.MaxAge < cfg.TTL+cfg.StaleTTL {
+		cfg.MaxAge = cfg.TTL + cfg.StaleTTL
+	}
+	return &toyCache{
+		cfg:   cfg,
+		ll:    list.New(),
+		items: make(map[int64]*list.Element),
+	}
+}
+
+// get serves toyID from the cache, calling fetch when the entry is missing or too old.
+// Entries past TTL but within StaleTTL are returned at once and refreshed in the
+// background. Older entries are fetched again, but until MaxAge they are still
+// preferred over a fetch that could not reach the toys service. Any answer from the
+// service other than an OK toy, such as NotFound for a deleted toy, evicts the entry.
+func (c *toyCache) get(ctx context.Context, toyID int64, fetch func(ctx context.Context) (*toys.GetToyResponse, error)) (*toys.GetToyResponse, error) {
+	cached, age, ok := c.lookup(toyID)
+	switch {
+	case ok && age <= c.cfg.TTL:
+		cacheHits.Add(1)
+		cacheRequests.WithLabelValues("hit").Inc()
+		return cached, nil
+	case ok && age <= c.cfg.TTL+c.cfg.StaleTTL:
+		cacheStaleHits.Add(1)
+		cacheRequests.WithLabelValues("stale_hit").Inc()
+		go c.fetch(context.WithoutCancel(ctx), toyID, fetch)
+		return cached, nil
+	}
+
+	cacheMisses.Add(1)
+	cacheRequests.WithLabelValues("miss").Inc()
+	resp, err := c.fetch(ctx, toyID, fetch)
+	if ok && unreachable(err) {
+		cacheStaleHits.Add(1)
+		cacheRequests.WithLabelValues("stale_hit").Inc()
+		return cached, nil
+	}
+	return resp, err
+}
+
+// fetch calls the toys service once for all concurrent callers asking for toyID. The
+// call is detached from ctx so that one caller giving up does not fail the others;
+// ctx only bounds how long this caller waits for it.
+func (c *toyCache) fetch(ctx context.Context, toyID int64, fetch func(ctx context.Context) (*toys.GetToyResponse, error)) (*toys.GetToyResponse, error) {
+	ch := c.group.DoChan(strconv.FormatInt(toyID, 10), func() (any, error) {
+		fetchCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), fetchTimeout)
+		defer cancel()
+
+		resp, err := fetch(fetchCtx)
+		switch {
+		case err == nil && resp.GetStatus() == toys.Status_STATUS_OK && resp.GetToy() != nil:
+			c.put(toyID, resp)
+		case !unreachable(err):
+			c.remove(toyID)
+		}
+		return resp, err
+	})
+
+	select {
+	case res := <-ch:
+		if res.Shared {
+			cacheShared.Add(1)
+		}
+		return proto.Clone(res.Val.(*toys.GetToyResponse)).(*toys.GetToyResponse), res.Err
+	case <-ctx.Done():
+		return &toys.GetToyResponse{Status: toys.Status_STATUS_INTERNAL_ERROR}, fmt.Errorf("%s: %w", "toys.grpc.GetToy", context.Cause(ctx))
+	}
+}
+
+// unreachable reports whether err means the toys service could not be asked, as
+// opposed to an answer from it.
+func unreachable(err error) bool {
+	if errors.Is(err, breaker.ErrUpstreamUnavailable) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded:
+		return true
+	}
+	return false
+}
+
+func (c *toyCache) lookup(toyID int64) (*toys.GetToyResponse, time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.items[toyID]
+	if !ok {
+		return nil, 0, false
+	}
+
+	entry := el.Value.(*toyEntry)
+	age := time.Since(entry.fetchedAt)
+	if age > c.cfg.MaxAge {
+		c.ll.Remove(el)
+		delete(c.items, toyID)
+		return nil, 0, false
+	}
+
+	c.ll.MoveToFront(el)
+	return proto.Clone(entry.resp).(*toys.GetToyResponse), age, true
+}
+
+func (c *toyCache) put(toyID int64, resp *toys.GetToyResponse) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	resp = proto.Clone(resp).(*toys.GetToyResponse)
+	if el, ok := c.items[toyID]; ok {
+		entry := el.Value.(*toyEntry)
+		entry.resp = resp
+		entry.fetchedAt = time.Now()
+		c.ll.MoveToFront(el)
+		return
+	}
+
+	c.items[toyID] = c.ll.PushFront(&toyEntry{
+		toyID:     toyID,
+		resp:      resp,
+		fetchedAt: time.Now(),
+	})
+	for c.ll.Len() > c.cfg.MaxEntries {
+		oldest := c.ll.Back()
+		c.ll.Remove(oldest)
+		delete(c.items, oldest.Value.(*toyEntry).toyID)
+	}
+}
+
+func (c *toyCache) remove(toyID int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.items[toyID]; ok {
+		c.ll.Remove(el)
+		delete(c.items, toyID)
+	}
+}
@@ -0,0 +1,223 @@
+package grpc
+
+import (
+	"cartService/internal/jsonlog"
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/spacecowboytobykty123/toysProto/gen/go/toys"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func toyResponse(id int64, title string) *toys.GetToyResponse {
+	return &toys.GetToyResponse{Status: toys.Status_STATUS_OK, Toy: &toys.Toy{Id: id, Title: title}}
+}
+
+func failedFetch(ctx context.Context) (*toys.GetToyResponse, error) {
+	return &toys.GetToyResponse{Status: toys.Status_STATUS_INTERNAL_ERROR}, status.Error(codes.Unavailable, "toys service down")
+}
+
+// age makes the cached entry of toyID look fetched d ago.
+func (c *toyCache) age(toyID int64, d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.items[toyID].Value.(*toyEntry).fetchedAt = time.Now().Add(-d)
+}
+
+func TestToyCacheServesFreshEntries(t *testing.T) {
+	c := newToyCache(CacheConfig{TTL: time.Minute})
+	c.put(1, toyResponse(1, "bear"))
+
+	resp, err := c.get(context.Background(), 1, func(ctx context.Context) (*toys.GetToyResponse, error) {
+		t.Fatal("fresh entry fetched again")
+		return nil, nil
+	})
+	if err != nil || resp.GetToy().GetTitle() != "bear" {
+		t.Fatalf("get = %v, %v", resp, err)
+	}
+}
+
+func TestToyCacheRefreshesStaleEntriesInBackground(t *testing.T) {
+	c := newToyCache(CacheConfig{TTL: time.Minute, StaleTTL: time.Minute})
+	c.put(1, toyResponse(1, "bear"))
+	c.age(1, 90*time.Second)
+
+	resp, err := c.get(context.Background(), 1, func(ctx context.Context) (*toys.GetToyResponse, error) {
+		return toyResponse(1, "teddy"), nil
+	})
+	if err != nil || resp.GetToy().GetTitle() != "bear" {
+		t.Fatalf("get = %v, %v, want the stale entry", resp, err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		if resp, _, _ := c.lookup(1); resp.GetToy().GetTitle() == "teddy" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("stale entry was not refreshed")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestToyCacheFallsBackUntilMaxAge(t *testing.T) {
+	c := newToyCache(CacheConfig{TTL: time.Minute, StaleTTL: time.Minute, MaxAge: time.Hour})
+	c.put(1, toyResponse(1, "bear"))
+
+	c.age(1, 30*time.Minute)
+	resp, err := c.get(context.Background(), 1, failedFetch)
+	if err != nil || resp.GetToy().GetTitle() != "bear" {
+		t.Fatalf("get past the stale window = %v, %v, want the old entry", resp, err)
+	}
+
+	c.age(1, 2*time.Hour)
+	resp, err = c.get(context.Background(), 1, failedFetch)
+	if err == nil || resp.GetStatus() != toys.Status_STATUS_INTERNAL_ERROR {
+		t.Fatalf("get past MaxAge = %v, %v, want the fetch error", resp, err)
+	}
+	if _, _, ok := c.lookup(1); ok {
+		t.Fatal("entry past MaxAge still cached")
+	}
+}
+
+func TestToyCacheEvictsDeletedToy(t *testing.T) {
+	c := newToyCache(CacheConfig{TTL: time.Minute, StaleTTL: time.Minute, MaxAge: time.Hour})
+	c.put(1, toyResponse(1, "bear"))
+	c.age(1, 30*time.Minute)
+
+	deleted := func(ctx context.Context) (*toys.GetToyResponse, error) {
+		return nil, status.Error(codes.NotFound, "toy 1 not found")
+	}
+	if _, err := c.get(context.Background(), 1, deleted); status.Code(err) != codes.NotFound {
+		t.Fatalf("get of a deleted toy = %v, want NotFound", err)
+	}
+	if _, _, ok := c.lookup(1); ok {
+		t.Fatal("deleted toy still cached")
+	}
+	if _, err := c.get(context.Background(), 1, failedFetch); status.Code(err) != codes.Unavailable {
+		t.Fatalf("get after the toy was evicted = %v, want the fetch error", err)
+	}
+}
+
+func TestToyCacheMaxAgeCoversStaleWindow(t *testing.T) {
+	c := newToyCache(CacheConfig{TTL: time.Minute, StaleTTL: time.Hour, MaxAge: time.Second})
+	if c.cfg.MaxAge != time.Minute+time.Hour {
+		t.Fatalf("MaxAge = %s, want TTL+StaleTTL", c.cfg.MaxAge)
+	}
+}
+
+func TestToyCacheFetchOutlivesCancelledCaller(t *testing.T) {
+	c := newToyCache(CacheConfig{TTL: time.Minute})
+
+	started := make(chan struct{})
+	release := make(chan struct{})
+	fetchErr := make(chan error, 1)
+	fetch := func(ctx context.Context) (*toys.GetToyResponse, error) {
+		close(started)
+		<-release
+		fetchErr <- ctx.Err()
+		return toyResponse(1, "bear"), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		_, err := c.get(ctx, 1, fetch)
+		done <- err
+	}()
+
+	<-started
+	cancel()
+	if err := <-done; !errors.Is(err, context.Canceled) {
+		t.Fatalf("cancelled caller got %v, want context.Canceled", err)
+	}
+
+	close(release)
+	if err := <-fetchErr; err != nil {
+		t.Fatalf("shared fetch saw %v after its caller left", err)
+	}
+	resp, err := c.get(context.Background(), 1, failedFetch)
+	if err != nil || resp.GetToy().GetTitle() != "bear" {
+		t.Fatalf("get after the fetch = %v, %v, want the fetched toy", resp, err)
+	}
+}
+
+// fakeToys answers GetToy from titles and fails every other id with UNAVAILABLE.
+type fakeToys struct {
+	toys.ToysClient
+
+	titles map[int64]string
+
+	mu       sync.Mutex
+	calls    map[int64]int
+	inFlight int
+	maxSeen  int
+}
+
+func (f *fakeToys) GetToy(ctx context.Context, in *toys.GetToyRequest, _ ...grpc.CallOption) (*toys.GetToyResponse, error) {
+	f.mu.Lock()
+	f.calls[in.GetToyId()]++
+	f.inFlight++
+	f.maxSeen = max(f.maxSeen, f.inFlight)
+	f.mu.Unlock()
+
+	time.Sleep(10 * time.Millisecond)
+
+	f.mu.Lock()
+	f.inFlight--
+	f.mu.Unlock()
+
+	title, ok := f.titles[in.GetToyId()]
+	if !ok {
+		return nil, status.Error(codes.Unavailable, "toys service down")
+	}
+	return toyResponse(in.GetToyId(), title), nil
+}
+
+func TestGetToys(t *testing.T) {
+	api := &fakeToys{
+		titles: map[int64]string{1: "bear", 2: "car", 3: "ball", 4: "kite", 5: "drum"},
+		calls:  make(map[int64]int),
+	}
+	client := &ToyClient{
+		toyApi:           api,
+		log:              jsonlog.New(io.Discard, jsonlog.LevelOff),
+		cache:            newToyCache(CacheConfig{TTL: time.Minute}),
+		batchConcurrency: 2,
+	}
+	client.cache.put(1, toyResponse(1, "cached bear"))
+
+	got := client.GetToys(context.Background(), []int64{1, 2, 3, 3, 4, 5, 6, 2})
+
+	want := map[int64]string{1: "cached bear", 2: "car", 3: "ball", 4: "kite", 5: "drum"}
+	if len(got) != 6 {
+		t.Fatalf("got %d toys, want 6", len(got))
+	}
+	for id, title := range want {
+		if got[id].GetToy().GetTitle() != title {
+			t.Errorf("toy %d = %v, want %q", id, got[id], title)
+		}
+	}
+	if got[6].GetStatus() != toys.Status_STATUS_INTERNAL_ERROR {
+		t.Errorf("toy 6 = %v, want STATUS_INTERNAL_ERROR", got[6])
+	}
+
+	if api.calls[1] != 0 {
+		t.Error("cached toy fetched from the service")
+	}
+	for id := int64(2); id <= 5; id++ {
+		if api.calls[id] != 1 {
+			t.Errorf("toy %d fetched %d times, want once", id, api.calls[id])
+		}
+	}
+	if api.maxSeen > 2 {
+		t.Errorf("%d calls in flight, want at most 2", api.maxSeen)
+	}
+}
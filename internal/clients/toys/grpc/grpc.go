@@ -1,101 +1,172 @@
 package grpc
 
 import (
+	"cartService/internal/clients/breaker"
+	"cartService/internal/clients/conn"
+	"cartService/internal/clients/credentials"
+	"cartService/internal/clients/requestid"
+	"cartService/internal/clients/retry"
 	"cartService/internal/jsonlog"
+	"cartService/internal/tracing"
 	"context"
+	"crypto/tls"
 	"fmt"
 	grpclog "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
-	grpcretry "github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/retry"
 	"github.com/spacecowboytobykty123/toysProto/gen/go/toys"
+	"golang.org/x/sync/errgroup"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	grpccreds "google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
-	"google.golang.org/grpc/metadata"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"sync"
 	"time"
 )
 
 type ToyClient struct {
-	toyApi toys.ToysClient
-	log    *jsonlog.Logger
+	toyApi           toys.ToysClient
+	healthApi        healthpb.HealthClient
+	log              *jsonlog.Logger
+	cache            *toyCache
+	batchConcurrency int
 }
 
-func New(ctx context.Context, log *jsonlog.Logger, timeout time.Duration, retriesCount int) (*ToyClient, error) {
+func New(ctx context.Context, log *jsonlog.Logger, connCfg conn.Config, retryCfg retry.Config, cacheCfg CacheConfig, creds credentials.Provider, tlsCfg *tls.Config, cb *breaker.Breaker) (*ToyClient, error) {
 
-	retryOpts := []grpcretry.CallOption{
-		grpcretry.WithCodes(codes.NotFound, codes.Aborted, codes.DeadlineExceeded),
-		grpcretry.WithMax(uint(retriesCount)),
-		grpcretry.WithPerRetryTimeout(timeout),
+	retryInterceptor, err := retry.UnaryClientInterceptor(retryCfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", "grpc.New", err)
 	}
 
 	logOpts := []grpclog.Option{
 		grpclog.WithLogOnEvents(grpclog.PayloadSent, grpclog.PayloadReceived),
 	}
 
-	cc, err := grpc.DialContext(ctx, "localhost:9000",
-		grpc.WithTransportCredentials(insecure.NewCredentials()),
-		grpc.WithChainUnaryInterceptor(
-			grpclog.UnaryClientInterceptor(InterceptorLogger(log), logOpts...),
-			grpcretry.UnaryClientInterceptor(retryOpts...),
-		),
+	// A nil tlsCfg keeps the connection in plaintext.
+	transport := insecure.NewCredentials()
+	if tlsCfg != nil {
+		transport = grpccreds.NewTLS(tlsCfg)
+	}
+
+	dialOpts, err := conn.DialOptions(connCfg)
+	if err != nil {
+		return nil, fmt.Errorf("%s:%w", "grpc.New", err)
+	}
+	// The breaker wraps the retries so an open breaker fails the call at once.
+	interceptors := []grpc.UnaryClientInterceptor{
+		grpclog.UnaryClientInterceptor(jsonlog.InterceptorLogger(log), logOpts...),
+	}
+	if cb != nil {
+		interceptors = append(interceptors, breaker.UnaryClientInterceptor(cb))
+	}
+	interceptors = append(interceptors,
+		retryInterceptor,
+		requestid.UnaryClientInterceptor(),
+		credentials.UnaryClientInterceptor(log, creds),
+	)
+
+	dialOpts = append(dialOpts,
+		grpc.WithTransportCredentials(transport),
+		grpc.WithStatsHandler(tracing.ClientHandler()),
+		grpc.WithChainUnaryInterceptor(interceptors...),
 	)
 
+	cc, err := grpc.DialContext(ctx, connCfg.Target, dialOpts...)
+
 	if err != nil {
 		return nil, fmt.Errorf("%s:%w", "grpc.New", err)
 	}
+	batchConcurrency := cacheCfg.BatchConcurrency
+	if batchConcurrency <= 0 {
+		batchConcurrency = 8
+	}
+
 	return &ToyClient{
-		toyApi: toys.NewToysClient(cc),
-		log:    log,
+		toyApi:           toys.NewToysClient(cc),
+		healthApi:        healthpb.NewHealthClient(cc),
+		log:              log,
+		cache:            newToyCache(cacheCfg),
+		batchConcurrency: batchConcurrency,
 	}, nil
 }
 
-func InterceptorLogger(logger *jsonlog.Logger) grpclog.Logger {
-	return grpclog.LoggerFunc(func(ctx context.Context, lvl grpclog.Level, msg string, fields ...any) {
-		logger.PrintInfo(msg, map[string]string{
-			"lvl": string(lvl),
-		})
-	},
-	)
+// GetToy always returns a response; when the toys service could not be asked its
+// status is STATUS_INTERNAL_ERROR and err says why, e.g. a *breaker.UnavailableError
+// while the circuit breaker is open.
+func (t *ToyClient) GetToy(ctx context.Context, toyID int64) (*toys.GetToyResponse, error) {
+	if t.cache == nil {
+		return t.getToy(ctx, toyID)
+	}
+	return t.cache.get(ctx, toyID, func(ctx context.Context) (*toys.GetToyResponse, error) {
+		return t.getToy(ctx, toyID)
+	})
 }
 
-func (t *ToyClient) GetToy(ctx context.Context, toyID int64) *toys.GetToyResponse {
-	t.log.PrintInfo("getting toy from toy microservice", map[string]string{
-		"method":  "toys.grpc.GetToy",
-		"service": "Toys",
-	})
+// GetToys fetches several toys at once, serving what it can from the cache and
+// calling the toys service for the rest with at most BatchConcurrency calls in flight.
+// Toys that could not be fetched have a STATUS_INTERNAL_ERROR response.
+func (t *ToyClient) GetToys(ctx context.Context, toyIDs []int64) map[int64]*toys.GetToyResponse {
+	result := make(map[int64]*toys.GetToyResponse, len(toyIDs))
+	var mu sync.Mutex
 
-	md, ok := metadata.FromIncomingContext(ctx)
-	if !ok {
-		t.log.PrintError(fmt.Errorf("missing metadata"), map[string]string{
-			"method":  "toys.grpc.GetToy",
-			"service": "Toys",
-		})
-		return &toys.GetToyResponse{
-			Status: toys.Status_STATUS_INTERNAL_ERROR,
-			Msg:    "missing metadata to connect to toys microservice",
+	g, ctx := errgroup.WithContext(ctx)
+	g.SetLimit(t.batchConcurrency)
+	for _, id := range toyIDs {
+		mu.Lock()
+		_, seen := result[id]
+		if !seen {
+			result[id] = nil
 		}
-	}
-
-	authHeader := md.Get("authorization")
-	if len(authHeader) == 0 {
-		t.log.PrintError(fmt.Errorf("missing authorization token"), nil)
-		return &toys.GetToyResponse{
-			Status: toys.Status_STATUS_INTERNAL_ERROR,
-			Msg:    "missing auth token to connect to toys microservice",
+		mu.Unlock()
+		if seen {
+			continue
 		}
+
+		g.Go(func() error {
+			resp, _ := t.GetToy(ctx, id)
+			mu.Lock()
+			result[id] = resp
+			mu.Unlock()
+			return nil
+		})
 	}
+	g.Wait()
+
+	return result
+}
 
-	outctx := metadata.NewOutgoingContext(ctx, metadata.Pairs("authorization", authHeader[0]))
-	t.log.PrintInfo("forwarding JWT token", map[string]string{
-		"token": authHeader[0],
+func (t *ToyClient) getToy(ctx context.Context, toyID int64) (*toys.GetToyResponse, error) {
+	t.log.PrintInfoContext(ctx, "getting toy from toy microservice", map[string]string{
+		"method":  "toys.grpc.GetToy",
+		"service": "Toys",
 	})
 
-	resp, err := t.toyApi.GetToy(outctx, &toys.GetToyRequest{ToyId: toyID})
+	start := time.Now()
+	resp, err := t.toyApi.GetToy(ctx, &toys.GetToyRequest{ToyId: toyID})
+	getToyDuration.WithLabelValues(status.Code(err).String()).Observe(time.Since(start).Seconds())
 	if err != nil {
-		t.log.PrintError(fmt.Errorf("cannot get response from toy service"), map[string]string{
+		t.log.PrintErrorContext(ctx, fmt.Errorf("cannot get response from toy service: %w", err), map[string]string{
 			"method": "toys.grpc.GetToy",
 		})
-		return &toys.GetToyResponse{Status: toys.Status_STATUS_INTERNAL_ERROR}
+		return &toys.GetToyResponse{Status: toys.Status_STATUS_INTERNAL_ERROR}, fmt.Errorf("%s: %w", "toys.grpc.GetToy", err)
 	}
 
-	return resp
+	return resp, nil
+}
+
+// Health asks the service's grpc.health.v1 endpoint whether it is serving. Services
+// that don't implement the health service count as healthy once they answer.
+func (t *ToyClient) Health(ctx context.Context) error {
+	resp, err := t.healthApi.Check(ctx, &healthpb.HealthCheckRequest{})
+	if status.Code(err) == codes.Unimplemented {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", "toys.grpc.Health", err)
+	}
+	if resp.GetStatus() != healthpb.HealthCheckResponse_SERVING {
+		return fmt.Errorf("toys.grpc.Health: service is %s", resp.GetStatus())
+	}
+	return nil
 }
@@ -0,0 +1,24 @@
+package grpc
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// getToyDuration measures calls that reach the network, retries included; cache hits are not
+// observed. The toys and subscriptions clients share the metric, told apart by the
+// service and method labels.
+var getToyDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:        "cart_client_request_duration_seconds",
+	Help:        "Time taken by calls to downstream services, by status code.",
+	ConstLabels: prometheus.Labels{"service": "toys", "method": "GetToy"},
+	Buckets:     []float64{.001, .0025, .005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5},
+}, []string{"code"})
+
+// cacheRequests counts lookups in the toy cache by result, hit, stale_hit or miss,
+// next to the toys_cache expvar map. The subscriptions client shares the metric.
+var cacheRequests = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name:        "cart_client_cache_requests_total",
+	Help:        "Lookups in the caches of downstream responses, by result.",
+	ConstLabels: prometheus.Labels{"service": "toys", "method": "GetToy"},
+}, []string{"result"})
@@ -2,4 +2,13 @@ package contextkeys
 
 type ContentKey string
 
-const UserIDKey = ContentKey("user_id")
+const (
+	UserIDKey = ContentKey("user_id")
+	RolesKey  = ContentKey("roles")
+	PlanKey   = ContentKey("plan")
+	TenantKey = ContentKey("tenant")
+	// ExpiresAtKey holds the expiry (time.Time) of the caller's token.
+	ExpiresAtKey = ContentKey("expires_at")
+	// RequestIDKey holds the x-request-id of the call being served.
+	RequestIDKey = ContentKey("request_id")
+)
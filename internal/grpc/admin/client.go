@@ -0,0 +1,47 @@
+package admin
+
+import (
+	"context"
+	"strconv"
+
+	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// Client calls the CartAdmin service, setting TargetUserHeader for each call.
+type Client struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewClient(cc grpc.ClientConnInterface) *Client {
+	return &Client{cc: cc}
+}
+
+func (c *Client) GetUserCart(ctx context.Context, userID int64, opts ...grpc.CallOption) (*cart_v1_crt.GetCartResponse, error) {
+	out := new(cart_v1_crt.GetCartResponse)
+	err := c.cc.Invoke(withTargetUser(ctx, userID), getUserCartMethod, &cart_v1_crt.GetCartRequest{}, out, opts...)
+	return out, err
+}
+
+func (c *Client) AddToUserCart(ctx context.Context, userID int64, in *cart_v1_crt.AddToCartRequest, opts ...grpc.CallOption) (*cart_v1_crt.AddToCartResponse, error) {
+	out := new(cart_v1_crt.AddToCartResponse)
+	err := c.cc.Invoke(withTargetUser(ctx, userID), addToUserCartMethod, in, out, opts...)
+	return out, err
+}
+
+func (c *Client) DelFromUserCart(ctx context.Context, userID int64, in *cart_v1_crt.DelFromCartRequest, opts ...grpc.CallOption) (*cart_v1_crt.DelFromCartResponse, error) {
+	out := new(cart_v1_crt.DelFromCartResponse)
+	err := c.cc.Invoke(withTargetUser(ctx, userID), delFromUserCartMethod, in, out, opts...)
+	return out, err
+}
+
+func (c *Client) ClearUserCart(ctx context.Context, userID int64, opts ...grpc.CallOption) (*cart_v1_crt.DelFromCartResponse, error) {
+	out := new(cart_v1_crt.DelFromCartResponse)
+	err := c.cc.Invoke(withTargetUser(ctx, userID), clearUserCartMethod, &cart_v1_crt.GetCartRequest{}, out, opts...)
+	return out, err
+}
+
+func withTargetUser(ctx context.Context, userID int64) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, TargetUserHeader, strconv.FormatInt(userID, 10))
+}
@@ -0,0 +1,227 @@
+package admin
+
+import (
+	"cartService/internal/auth"
+	"cartService/internal/data"
+	crtgrpc "cartService/internal/grpc/cart"
+	"cartService/internal/validator"
+	"cartService/storage/postgres"
+	"context"
+	"strconv"
+
+	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// The admin service is not part of the published cart proto, so its descriptor is
+// written by hand. It reuses the cart messages; the user whose cart is inspected or
+// edited travels in the TargetUserHeader metadata.
+const (
+	ServiceName      = "cart.CartAdmin"
+	TargetUserHeader = "x-target-user-id"
+	AdminRole        = "admin"
+)
+
+const (
+	getUserCartMethod     = "/" + ServiceName + "/GetUserCart"
+	addToUserCartMethod   = "/" + ServiceName + "/AddToUserCart"
+	delFromUserCartMethod = "/" + ServiceName + "/DelFromUserCart"
+	clearUserCartMethod   = "/" + ServiceName + "/ClearUserCart"
+)
+
+type Admin interface {
+	GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32)
+	AddToCart(ctx context.Context, userID int64, toy data.CartItem) (cart_v1_crt.OperationStatus, string)
+	DelFromCart(ctx context.Context, userID int64, toyId int64) (cart_v1_crt.OperationStatus, string)
+	ClearCart(ctx context.Context, userID int64) (cart_v1_crt.OperationStatus, string)
+	// Rejected is told about every call refused before it reaches the cart: for a
+	// missing admin role, a missing or invalid target user or an invalid request.
+	// userID is 0 when the call named no valid target.
+	Rejected(ctx context.Context, action string, userID int64, err error)
+}
+
+type serverAPI struct {
+	admin Admin
+}
+
+func Register(gRPC *grpc.Server, admin Admin) {
+	gRPC.RegisterService(&serviceDesc, &serverAPI{admin: admin})
+}
+
+func (s *serverAPI) GetUserCart(ctx context.Context, r *cart_v1_crt.GetCartRequest) (*cart_v1_crt.GetCartResponse, error) {
+	userID, err := s.authorize(ctx, "get_cart")
+	if err != nil {
+		return nil, err
+	}
+
+	toys, totalItems, totalQty := s.admin.GetCart(ctx, userID)
+	if toys == nil {
+		return nil, status.Error(codes.Internal, "failed to fetch cart")
+	}
+	return &cart_v1_crt.GetCartResponse{
+		Items:         crtgrpc.ToDomainOrder(toys),
+		TotalItems:    totalItems,
+		TotalQuantity: totalQty,
+	}, nil
+}
+
+func (s *serverAPI) AddToUserCart(ctx context.Context, r *cart_v1_crt.AddToCartRequest) (*cart_v1_crt.AddToCartResponse, error) {
+	userID, err := s.authorize(ctx, "add_to_cart")
+	if err != nil {
+		return nil, err
+	}
+
+	v := validator.New()
+	toy := r.GetToy()
+	inputToy := data.CartItem{
+		ToyID:    toy.GetToyId(),
+		Quantity: toy.GetQuantity(),
+	}
+	if postgres.ValidateToy(v, inputToy); !v.Valid() {
+		return nil, s.reject(ctx, "add_to_cart", userID, status.Error(codes.InvalidArgument, "toy id and quantity must be provided"))
+	}
+
+	opStatus, msg := s.admin.AddToCart(ctx, userID, inputToy)
+	return &cart_v1_crt.AddToCartResponse{
+		OpStatus: opStatus,
+		Message:  msg,
+	}, nil
+}
+
+func (s *serverAPI) DelFromUserCart(ctx context.Context, r *cart_v1_crt.DelFromCartRequest) (*cart_v1_crt.DelFromCartResponse, error) {
+	userID, err := s.authorize(ctx, "del_from_cart")
+	if err != nil {
+		return nil, err
+	}
+	if r.GetToyId() == 0 {
+		return nil, s.reject(ctx, "del_from_cart", userID, status.Error(codes.InvalidArgument, "toy id must be provided"))
+	}
+
+	opStatus, msg := s.admin.DelFromCart(ctx, userID, r.GetToyId())
+	return &cart_v1_crt.DelFromCartResponse{
+		OpStatus: opStatus,
+		Message:  msg,
+	}, nil
+}
+
+func (s *serverAPI) ClearUserCart(ctx context.Context, r *cart_v1_crt.GetCartRequest) (*cart_v1_crt.DelFromCartResponse, error) {
+	userID, err := s.authorize(ctx, "clear_cart")
+	if err != nil {
+		return nil, err
+	}
+
+	opStatus, msg := s.admin.ClearCart(ctx, userID)
+	return &cart_v1_crt.DelFromCartResponse{
+		OpStatus: opStatus,
+		Message:  msg,
+	}, nil
+}
+
+// authorize checks that the caller has the admin role and returns the target user id.
+// Rejected calls are audited as attempts at action.
+func (s *serverAPI) authorize(ctx context.Context, action string) (int64, error) {
+	userID, err := targetUser(ctx)
+	if !auth.HasRole(ctx, AdminRole) {
+		return 0, s.reject(ctx, action, userID, status.Error(codes.PermissionDenied, "admin role required"))
+	}
+	if err != nil {
+		return 0, s.reject(ctx, action, 0, err)
+	}
+	return userID, nil
+}
+
+// reject audits a call to action refused with err and returns err.
+func (s *serverAPI) reject(ctx context.Context, action string, userID int64, err error) error {
+	s.admin.Rejected(ctx, action, userID, err)
+	return err
+}
+
+func targetUser(ctx context.Context) (int64, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(TargetUserHeader)
+	if len(values) == 0 {
+		return 0, status.Error(codes.InvalidArgument, TargetUserHeader+" metadata is required")
+	}
+
+	userID, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil || userID <= 0 {
+		return 0, status.Error(codes.InvalidArgument, "invalid "+TargetUserHeader)
+	}
+	return userID, nil
+}
+
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: ServiceName,
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{MethodName: "GetUserCart", Handler: getUserCartHandler},
+		{MethodName: "AddToUserCart", Handler: addToUserCartHandler},
+		{MethodName: "DelFromUserCart", Handler: delFromUserCartHandler},
+		{MethodName: "ClearUserCart", Handler: clearUserCartHandler},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "admin",
+}
+
+func getUserCartHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(cart_v1_crt.GetCartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(*serverAPI).GetUserCart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: getUserCartMethod}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(*serverAPI).GetUserCart(ctx, req.(*cart_v1_crt.GetCartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func addToUserCartHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(cart_v1_crt.AddToCartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(*serverAPI).AddToUserCart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: addToUserCartMethod}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(*serverAPI).AddToUserCart(ctx, req.(*cart_v1_crt.AddToCartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func delFromUserCartHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(cart_v1_crt.DelFromCartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(*serverAPI).DelFromUserCart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: delFromUserCartMethod}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(*serverAPI).DelFromUserCart(ctx, req.(*cart_v1_crt.DelFromCartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func clearUserCartHandler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(cart_v1_crt.GetCartRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(*serverAPI).ClearUserCart(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{Server: srv, FullMethod: clearUserCartMethod}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(*serverAPI).ClearUserCart(ctx, req.(*cart_v1_crt.GetCartRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
@@ -22,10 +22,12 @@ type Carts interface {
 	AddToCart(ctx context.Context, toy data.CartItem) (cart_v1_crt.OperationStatus, string)
 	DelFromCart(ctx context.Context, toyId int64) (cart_v1_crt.OperationStatus, string)
 	GetCart(ctx context.Context) ([]*data.CartItem, int32, int32)
+	WatchCart(ctx context.Context, send func(toys []*data.CartItem, totalItems int32, totalQty int32) error) error
 }
 
 func Register(gRPC *grpc.Server, carts Carts) {
 	cart_v1_crt.RegisterCartServer(gRPC, &serverAPI{carts: carts})
+	gRPC.RegisterService(&watchServiceDesc, &watchServer{carts: carts})
 }
 
 const (
@@ -57,7 +59,7 @@ func (s *serverAPI) DelFromCart(ctx context.Context, r *cart_v1_crt.DelFromCartR
 	toyID := r.GetToyId()
 
 	if toyID == emptyValue {
-		return nil, nil
+		return nil, status.Error(codes.InvalidArgument, "toy id must be provided")
 	}
 
 	opStatus, msg := s.carts.DelFromCart(ctx, toyID)
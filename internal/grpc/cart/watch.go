@@ -0,0 +1,93 @@
+package cart
+
+import (
+	"cartService/internal/data"
+	"context"
+
+	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
+	"google.golang.org/grpc"
+)
+
+// WatchCart is not part of the published cart proto yet, so the streaming service is
+// described by hand. It takes a GetCartRequest and streams a GetCartResponse with the
+// full cart every time it changes.
+const (
+	WatchServiceName = "cart.CartWatch"
+	watchCartMethod  = "/" + WatchServiceName + "/WatchCart"
+)
+
+type watchServer struct {
+	carts Carts
+}
+
+func (s *watchServer) WatchCart(r *cart_v1_crt.GetCartRequest, stream grpc.ServerStream) error {
+	return s.carts.WatchCart(stream.Context(), func(toys []*data.CartItem, totalItems int32, totalQty int32) error {
+		return stream.SendMsg(&cart_v1_crt.GetCartResponse{
+			Items:         ToDomainOrder(toys),
+			TotalItems:    totalItems,
+			TotalQuantity: totalQty,
+		})
+	})
+}
+
+func watchCartHandler(srv interface{}, stream grpc.ServerStream) error {
+	in := new(cart_v1_crt.GetCartRequest)
+	if err := stream.RecvMsg(in); err != nil {
+		return err
+	}
+	return srv.(*watchServer).WatchCart(in, stream)
+}
+
+var watchServiceDesc = grpc.ServiceDesc{
+	ServiceName: WatchServiceName,
+	HandlerType: (*any)(nil),
+	Methods:     []grpc.MethodDesc{},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName:    "WatchCart",
+			Handler:       watchCartHandler,
+			ServerStreams: true,
+		},
+	},
+	Metadata: "watch",
+}
+
+// WatchClient receives cart updates from the CartWatch service.
+type WatchClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewWatchClient(cc grpc.ClientConnInterface) *WatchClient {
+	return &WatchClient{cc: cc}
+}
+
+type CartUpdates interface {
+	Recv() (*cart_v1_crt.GetCartResponse, error)
+	grpc.ClientStream
+}
+
+type cartUpdates struct {
+	grpc.ClientStream
+}
+
+func (u *cartUpdates) Recv() (*cart_v1_crt.GetCartResponse, error) {
+	m := new(cart_v1_crt.GetCartResponse)
+	if err := u.ClientStream.RecvMsg(m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (c *WatchClient) WatchCart(ctx context.Context, opts ...grpc.CallOption) (CartUpdates, error) {
+	stream, err := c.cc.NewStream(ctx, &watchServiceDesc.Streams[0], watchCartMethod, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if err := stream.SendMsg(&cart_v1_crt.GetCartRequest{}); err != nil {
+		return nil, err
+	}
+	if err := stream.CloseSend(); err != nil {
+		return nil, err
+	}
+	return &cartUpdates{ClientStream: stream}, nil
+}
@@ -0,0 +1,190 @@
+package health
+
+import (
+	"cartService/internal/jsonlog"
+	"context"
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+// Check reports whether one dependency is usable.
+type Check struct {
+	Name string
+	Func func(ctx context.Context) error
+	// Optional checks are reported but don't make the service unready.
+	Optional bool
+}
+
+type result struct {
+	Healthy   bool      `json:"healthy"`
+	Optional  bool      `json:"optional,omitempty"`
+	Error     string    `json:"error,omitempty"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Monitor runs checks periodically and mirrors the outcome into a grpc.health.v1
+// server: every service in services is SERVING while all required checks pass and
+// NOT_SERVING otherwise.
+type Monitor struct {
+	log      *jsonlog.Logger
+	server   *health.Server
+	services []string
+	checks   []Check
+	interval time.Duration
+	timeout  time.Duration
+
+	mu      sync.RWMutex
+	results map[string]result
+	ready   bool
+}
+
+func NewMonitor(log *jsonlog.Logger, server *health.Server, services []string, interval, timeout time.Duration, checks ...Check) *Monitor {
+	if timeout <= 0 || timeout > interval {
+		timeout = interval
+	}
+	m := &Monitor{
+		log:      log,
+		server:   server,
+		services: services,
+		checks:   checks,
+		interval: interval,
+		timeout:  timeout,
+		results:  make(map[string]result),
+	}
+	// Nothing is known until the first run.
+	m.setServing(false)
+	return m
+}
+
+// Run checks right away and then every interval until ctx is done. The health
+// server is left NOT_SERVING when Run returns so a stopping process drains.
+func (m *Monitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.interval)
+	defer ticker.Stop()
+
+	for {
+		m.checkAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			m.setServing(false)
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (m *Monitor) checkAll(ctx context.Context) {
+	results := make(map[string]result, len(m.checks))
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+
+	for _, c := range m.checks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			checkCtx, cancel := context.WithTimeout(ctx, m.timeout)
+			err := c.Func(checkCtx)
+			cancel()
+
+			r := result{Healthy: err == nil, Optional: c.Optional, CheckedAt: time.Now()}
+			if err != nil {
+				r.Error = err.Error()
+			}
+			mu.Lock()
+			results[c.Name] = r
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+
+	ready := true
+	for _, c := range m.checks {
+		r := results[c.Name]
+		if !r.Healthy && !c.Optional {
+			ready = false
+		}
+	}
+
+	m.mu.Lock()
+	previous := m.results
+	wasReady := m.ready
+	m.results = results
+	m.ready = ready
+	m.mu.Unlock()
+
+	for name, r := range results {
+		if p, ok := previous[name]; ok && p.Healthy == r.Healthy {
+			continue
+		}
+		if r.Healthy {
+			m.log.PrintInfo("dependency healthy", map[string]string{
+				"method":     "health.checkAll",
+				"dependency": name,
+			})
+		} else {
+			m.log.PrintInfo("dependency unhealthy", map[string]string{
+				"method":     "health.checkAll",
+				"dependency": name,
+				"error":      r.Error,
+			})
+		}
+	}
+	if ready != wasReady || len(previous) == 0 {
+		m.setServing(ready)
+	}
+}
+
+func (m *Monitor) setServing(serving bool) {
+	st := healthpb.HealthCheckResponse_NOT_SERVING
+	if serving {
+		st = healthpb.HealthCheckResponse_SERVING
+	}
+	for _, svc := range m.services {
+		m.server.SetServingStatus(svc, st)
+	}
+}
+
+// Ready reports whether every required check passed on the last run.
+func (m *Monitor) Ready() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.ready
+}
+
+// Healthz is the liveness endpoint: it answers as long as the process can serve HTTP.
+func Healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// Readyz reports the last result of every check, with 503 while a required one fails.
+func (m *Monitor) Readyz(w http.ResponseWriter, r *http.Request) {
+	m.mu.RLock()
+	ready := m.ready
+	results := make(map[string]result, len(m.results))
+	for k, v := range m.results {
+		results[k] = v
+	}
+	m.mu.RUnlock()
+
+	code, st := http.StatusOK, "ready"
+	if !ready {
+		code, st = http.StatusServiceUnavailable, "not ready"
+	}
+	writeJSON(w, code, map[string]any{
+		"status": st,
+		"checks": results,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
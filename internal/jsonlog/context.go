@@ -0,0 +1,58 @@
+package jsonlog
+
+import (
+	"cartService/internal/contextkeys"
+	"context"
+)
+
+// PrintInfoContext is PrintInfo with the request id and user id of ctx added to the
+// properties, so every entry of one call can be found together.
+func (l *Logger) PrintInfoContext(ctx context.Context, message string, properties map[string]string) {
+	l.print(LevelInfo, message, withContext(ctx, stringFields(properties)))
+}
+
+func (l *Logger) PrintDebugContext(ctx context.Context, message string, properties map[string]string) {
+	if !l.Enabled(LevelDebug) {
+		return
+	}
+	l.print(LevelDebug, message, withContext(ctx, stringFields(properties)))
+}
+
+func (l *Logger) PrintWarnContext(ctx context.Context, message string, properties map[string]string) {
+	l.print(LevelWarn, message, withContext(ctx, stringFields(properties)))
+}
+
+func (l *Logger) PrintErrorContext(ctx context.Context, err error, properties map[string]string) {
+	l.print(LevelError, err.Error(), withContext(ctx, stringFields(properties)))
+}
+
+// LogContext is Log with the request id and user id of ctx added.
+func (l *Logger) LogContext(ctx context.Context, level Level, message string, fields ...Field) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.print(level, message, withContext(ctx, fieldMap(fields)))
+}
+
+// withContext adds "request_id" and "user_id" taken from ctx to properties. Properties
+// set by the caller win.
+func withContext(ctx context.Context, properties map[string]any) map[string]any {
+	requestID, _ := ctx.Value(contextkeys.RequestIDKey).(string)
+	userID, hasUser := ctx.Value(contextkeys.UserIDKey).(int64)
+	if requestID == "" && !hasUser {
+		return properties
+	}
+
+	fields := make([]Field, 0, 2)
+	if requestID != "" {
+		fields = append(fields, String("request_id", requestID))
+	}
+	if hasUser {
+		fields = append(fields, Int64("user_id", userID))
+	}
+	merged := fieldMap(fields)
+	for k, v := range properties {
+		merged[k] = v
+	}
+	return merged
+}
@@ -0,0 +1,55 @@
+package jsonlog
+
+import (
+	"bytes"
+	"cartService/internal/contextkeys"
+	"context"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestWithContext(t *testing.T) {
+	withRequest := context.WithValue(context.Background(), contextkeys.RequestIDKey, "req-1")
+	withUser := context.WithValue(withRequest, contextkeys.UserIDKey, int64(42))
+
+	tests := []struct {
+		name       string
+		ctx        context.Context
+		properties map[string]any
+		want       map[string]any
+	}{
+		{"nothing in ctx", context.Background(), map[string]any{"method": "m"}, map[string]any{"method": "m"}},
+		{"request id", withRequest, nil, map[string]any{"request_id": "req-1"}},
+		{"request and user id", withUser, map[string]any{"method": "m"}, map[string]any{"request_id": "req-1", "user_id": int64(42), "method": "m"}},
+		{"caller wins", withUser, map[string]any{"user_id": "admin"}, map[string]any{"request_id": "req-1", "user_id": "admin"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := withContext(tt.ctx, tt.properties); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("withContext = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogContext(t *testing.T) {
+	ctx := context.WithValue(context.Background(), contextkeys.RequestIDKey, "req-1")
+	ctx = context.WithValue(ctx, contextkeys.UserIDKey, int64(9007199254740993))
+
+	var out bytes.Buffer
+	New(&out, LevelInfo).LogContext(ctx, LevelInfo, "toy added", Int64("toy_id", 10))
+
+	var entry struct {
+		Properties map[string]json.RawMessage
+	}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("entry %q: %v", out.String(), err)
+	}
+	want := map[string]string{"request_id": `"req-1"`, "user_id": "9007199254740993", "toy_id": "10"}
+	for k, v := range want {
+		if got := string(entry.Properties[k]); got != v {
+			t.Errorf("%s = %s, want %s", k, got, v)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package jsonlog
+
+import (
+	"time"
+)
+
+// Field is a typed property of an entry logged with Log. Values are written as their
+// JSON type: numbers stay numbers and Object nests a JSON object.
+type Field struct {
+	Key   string
+	Value any
+}
+
+func String(key, value string) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int(key string, value int) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Int64(key string, value int64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Float64(key string, value float64) Field {
+	return Field{Key: key, Value: value}
+}
+
+func Bool(key string, value bool) Field {
+	return Field{Key: key, Value: value}
+}
+
+// Duration is written in Go notation, e.g. "1.5s".
+func Duration(key string, value time.Duration) Field {
+	return Field{Key: key, Value: value.String()}
+}
+
+func Time(key string, value time.Time) Field {
+	return Field{Key: key, Value: value.UTC().Format(time.RFC3339Nano)}
+}
+
+// Err is written under "error"; a nil err is skipped.
+func Err(err error) Field {
+	if err == nil {
+		return Field{}
+	}
+	return Field{Key: "error", Value: err.Error()}
+}
+
+// Object nests fields under key.
+func Object(key string, fields ...Field) Field {
+	return Field{Key: key, Value: fieldMap(fields)}
+}
+
+// Any writes value with encoding/json. Redaction only sees into strings, Object
+// fields, maps and slices, not into structs.
+func Any(key string, value any) Field {
+	return Field{Key: key, Value: value}
+}
+
+func fieldMap(fields []Field) map[string]any {
+	m := make(map[string]any, len(fields))
+	for _, f := range fields {
+		if f.Key != "" {
+			m[f.Key] = f.Value
+		}
+	}
+	return m
+}
@@ -0,0 +1,112 @@
+package jsonlog
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"google.golang.org/grpc/grpclog"
+)
+
+// InterceptorLogger adapts l to the go-grpc-middleware logging interceptors. The
+// fields of each call (grpc.service, grpc.code, grpc.time_ms, ...) become properties
+// and the interceptor's level is kept, except that entries carrying a whole request or
+// response are written at DEBUG.
+func InterceptorLogger(l *Logger) logging.Logger {
+	logger := slog.New(l.SlogHandler())
+	return logging.LoggerFunc(func(ctx context.Context, lvl logging.Level, msg string, fields ...any) {
+		level := slog.Level(lvl)
+		if hasPayload(fields) {
+			level = min(level, slog.LevelDebug)
+		}
+		logger.Log(ctx, level, msg, fields...)
+	})
+}
+
+// hasPayload reports whether the key-value pairs of an interceptor entry include the
+// content of a message.
+func hasPayload(fields []any) bool {
+	for i := 0; i+1 < len(fields); i += 2 {
+		switch fields[i] {
+		case "grpc.request.content", "grpc.response.content":
+			return true
+		}
+	}
+	return false
+}
+
+// GRPCLogger returns a grpclog.LoggerV2 writing the logs of the gRPC library to l,
+// with "component":"grpc". gRPC INFO entries are very chatty and are written at
+// DEBUG; verbosity is the level V reports as enabled, as GRPC_GO_LOG_VERBOSITY_LEVEL
+// does for the default logger. Install it with grpclog.SetLoggerV2 before any other
+// gRPC call.
+func GRPCLogger(l *Logger, verbosity int) grpclog.LoggerV2 {
+	return &grpcLogger{log: l, verbosity: verbosity}
+}
+
+type grpcLogger struct {
+	log       *Logger
+	verbosity int
+}
+
+func (g *grpcLogger) print(level Level, message string) {
+	if !g.log.Enabled(level) {
+		return
+	}
+	g.log.print(level, message, map[string]any{"component": "grpc"})
+}
+
+func (g *grpcLogger) Info(args ...any) {
+	g.print(LevelDebug, fmt.Sprint(args...))
+}
+func (g *grpcLogger) Infoln(args ...any) {
+	g.print(LevelDebug, sprintln(args...))
+}
+func (g *grpcLogger) Infof(format string, args ...any) {
+	g.print(LevelDebug, fmt.Sprintf(format, args...))
+}
+
+func (g *grpcLogger) Warning(args ...any) {
+	g.print(LevelWarn, fmt.Sprint(args...))
+}
+func (g *grpcLogger) Warningln(args ...any) {
+	g.print(LevelWarn, sprintln(args...))
+}
+func (g *grpcLogger) Warningf(format string, args ...any) {
+	g.print(LevelWarn, fmt.Sprintf(format, args...))
+}
+
+func (g *grpcLogger) Error(args ...any) {
+	g.print(LevelError, fmt.Sprint(args...))
+}
+func (g *grpcLogger) Errorln(args ...any) {
+	g.print(LevelError, sprintln(args...))
+}
+func (g *grpcLogger) Errorf(format string, args ...any) {
+	g.print(LevelError, fmt.Sprintf(format, args...))
+}
+
+// The Fatal methods exit, as grpclog.LoggerV2 requires.
+func (g *grpcLogger) Fatal(args ...any) {
+	g.print(LevelFatal, fmt.Sprint(args...))
+	os.Exit(1)
+}
+func (g *grpcLogger) Fatalln(args ...any) {
+	g.print(LevelFatal, sprintln(args...))
+	os.Exit(1)
+}
+func (g *grpcLogger) Fatalf(format string, args ...any) {
+	g.print(LevelFatal, fmt.Sprintf(format, args...))
+	os.Exit(1)
+}
+
+func (g *grpcLogger) V(level int) bool {
+	return level <= g.verbosity
+}
+
+func sprintln(args ...any) string {
+	return strings.TrimSuffix(fmt.Sprintln(args...), "\n")
+}
@@ -0,0 +1,57 @@
+package jsonlog
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/grpc-ecosystem/go-grpc-middleware/v2/interceptors/logging"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+func TestInterceptorLoggerPayloads(t *testing.T) {
+	payload, err := structpb.NewStruct(map[string]any{
+		"toy_id": 10,
+		"token":  "secret-token",
+		"items":  []any{map[string]any{"password": "hunter2"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	l := New(&out, LevelInfo)
+	logger := InterceptorLogger(l)
+
+	logger.Log(context.Background(), logging.LevelInfo, "finished call", "grpc.code", "OK")
+	logger.Log(context.Background(), logging.LevelInfo, "request sent", "grpc.request.content", payload)
+	if got := strings.Count(out.String(), "\n"); got != 1 {
+		t.Fatalf("%d entries at INFO, want only the one without a payload:\n%s", got, out.String())
+	}
+
+	out.Reset()
+	l.SetLevel(LevelDebug)
+	logger.Log(context.Background(), logging.LevelInfo, "request sent", "grpc.request.content", payload)
+
+	var entry struct {
+		Level      string         `json:"level"`
+		Properties map[string]any `json:"properties"`
+	}
+	if err := json.Unmarshal(out.Bytes(), &entry); err != nil {
+		t.Fatalf("entry %q: %v", out.String(), err)
+	}
+	if entry.Level != "DEBUG" {
+		t.Errorf("payload logged at %s, want DEBUG", entry.Level)
+	}
+	content, _ := json.Marshal(entry.Properties["grpc.request.content"])
+	for _, secret := range []string{"secret-token", "hunter2"} {
+		if strings.Contains(string(content), secret) {
+			t.Errorf("payload %s leaks %q", content, secret)
+		}
+	}
+	if !strings.Contains(string(content), `"toy_id":10`) {
+		t.Errorf("payload %s lost its fields", content)
+	}
+}
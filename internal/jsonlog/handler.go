@@ -0,0 +1,51 @@
+package jsonlog
+
+import (
+	"encoding/json"
+	"net/http"
+)
+
+// LevelHandler reports the current level on GET and changes it on PUT, with a body
+// such as {"level":"DEBUG"}. It does no authentication of its own.
+func (l *Logger) LevelHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var current Level
+		switch r.Method {
+		case http.MethodGet:
+			current = l.Level()
+		case http.MethodPut:
+			var body struct {
+				Level string `json:"level"`
+			}
+			if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, 1<<10)).Decode(&body); err != nil {
+				http.Error(w, "invalid body: "+err.Error(), http.StatusBadRequest)
+				return
+			}
+			level, err := ParseLevel(body.Level)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// Swapping applies the level in one step, so the last of concurrent
+			// changes wins and each one logs the level it really replaced. The change
+			// is logged if either of the two levels lets WARN through.
+			previous := Level(l.minLevel.Swap(int32(level)))
+			if min(previous, level) <= LevelWarn {
+				l.write(LevelWarn, "log level changed", withContext(r.Context(), map[string]any{
+					"method":   "jsonlog.LevelHandler",
+					"previous": previous.String(),
+					"level":    level.String(),
+				}))
+			}
+			current = level
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]string{"level": current.String()})
+	})
+}
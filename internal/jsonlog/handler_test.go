@@ -0,0 +1,84 @@
+package jsonlog
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLevelHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		method     string
+		body       string
+		wantStatus int
+		wantLevel  Level
+	}{
+		{"get", http.MethodGet, "", http.StatusOK, LevelInfo},
+		{"put", http.MethodPut, `{"level":"debug"}`, http.StatusOK, LevelDebug},
+		{"put unknown level", http.MethodPut, `{"level":"TRACE"}`, http.StatusBadRequest, LevelInfo},
+		{"put malformed body", http.MethodPut, `level=DEBUG`, http.StatusBadRequest, LevelInfo},
+		{"post", http.MethodPost, `{"level":"DEBUG"}`, http.StatusMethodNotAllowed, LevelInfo},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			l := New(&bytes.Buffer{}, LevelInfo)
+			rec := httptest.NewRecorder()
+			l.LevelHandler().ServeHTTP(rec, httptest.NewRequest(tt.method, "/debug/log-level", strings.NewReader(tt.body)))
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status %d, want %d: %s", rec.Code, tt.wantStatus, rec.Body)
+			}
+			if l.Level() != tt.wantLevel {
+				t.Fatalf("level %s, want %s", l.Level(), tt.wantLevel)
+			}
+			switch rec.Code {
+			case http.StatusOK:
+				var body struct{ Level string }
+				if err := json.Unmarshal(rec.Body.Bytes(), &body); err != nil || body.Level != tt.wantLevel.String() {
+					t.Fatalf("body %s, want level %s", rec.Body, tt.wantLevel)
+				}
+			case http.StatusMethodNotAllowed:
+				if allow := rec.Header().Get("Allow"); allow != "GET, PUT" {
+					t.Fatalf("Allow = %q, want GET, PUT", allow)
+				}
+			}
+		})
+	}
+}
+
+func TestLevelHandlerLogsChange(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out, LevelInfo)
+	put := func(level string) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		l.LevelHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodPut, "/debug/log-level", strings.NewReader(`{"level":"`+level+`"}`)))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("PUT %s: status %d", level, rec.Code)
+		}
+	}
+
+	// Raised past WARN, the change is still logged.
+	put("ERROR")
+	put("OFF")
+	put("INFO")
+
+	var changes []string
+	for _, line := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var entry struct {
+			Message    string
+			Properties map[string]string
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("entry %q: %v", line, err)
+		}
+		changes = append(changes, entry.Properties["previous"]+"->"+entry.Properties["level"])
+	}
+	if want := "INFO->ERROR OFF->INFO"; strings.Join(changes, " ") != want {
+		t.Fatalf("logged changes %v, want %s", changes, want)
+	}
+}
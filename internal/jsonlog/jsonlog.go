@@ -2,17 +2,23 @@ package jsonlog
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"runtime/debug"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Level int8
 
+// LevelInfo stays the zero value.
 const (
-	LevelInfo Level = iota
+	LevelDebug Level = iota - 1
+	LevelInfo
+	LevelWarn
 	LevelError
 	LevelFatal
 	LevelOff
@@ -20,60 +26,140 @@ const (
 
 func (l Level) String() string {
 	switch l {
+	case LevelDebug:
+		return "DEBUG"
 	case LevelInfo:
 		return "INFO"
+	case LevelWarn:
+		return "WARN"
 	case LevelError:
 		return "ERROR"
 	case LevelFatal:
 		return "FATAL"
+	case LevelOff:
+		return "OFF"
 	default:
 		return ""
 	}
 }
 
+// ParseLevel accepts the names returned by String, in any case.
+func ParseLevel(s string) (Level, error) {
+	for l := LevelDebug; l <= LevelOff; l++ {
+		if strings.EqualFold(s, l.String()) {
+			return l, nil
+		}
+	}
+	return 0, fmt.Errorf("jsonlog.ParseLevel: unknown level %q", s)
+}
+
 type Logger struct {
-	out      io.Writer
-	minLevel Level
-	mu       sync.Mutex
+	out        io.Writer
+	minLevel   atomic.Int32
+	stackLevel atomic.Int32
+	redact     atomic.Pointer[RedactionPolicy]
+	sampler    atomic.Pointer[sampler]
+	mu         sync.Mutex
 }
 
+// New returns a Logger applying DefaultRedactionPolicy to every entry and capturing a
+// stack trace for ERROR and FATAL entries.
 func New(out io.Writer, minLevel Level) *Logger {
-	return &Logger{
-		out:      out,
-		minLevel: minLevel,
+	l := &Logger{
+		out: out,
 	}
+	l.minLevel.Store(int32(minLevel))
+	l.stackLevel.Store(int32(LevelError))
+	l.redact.Store(DefaultRedactionPolicy())
+	return l
+}
+
+// SetLevel changes the minimum level written; it is safe to call while logging.
+func (l *Logger) SetLevel(level Level) {
+	l.minLevel.Store(int32(level))
+}
+
+func (l *Logger) Level() Level {
+	return Level(l.minLevel.Load())
 }
 
+// Enabled reports whether entries at level are written, so callers can skip building
+// expensive fields.
+func (l *Logger) Enabled(level Level) bool {
+	return level >= l.Level()
+}
+
+// SetStackLevel makes entries at level and above carry the stack of the logging
+// goroutine; LevelOff disables stack traces.
+func (l *Logger) SetStackLevel(level Level) {
+	l.stackLevel.Store(int32(level))
+}
+
+// SetRedactionPolicy replaces the redaction policy; nil disables redaction.
+func (l *Logger) SetRedactionPolicy(p *RedactionPolicy) {
+	l.redact.Store(p)
+}
+
+func (l *Logger) PrintDebug(message string, properties map[string]string) {
+	if !l.Enabled(LevelDebug) {
+		return
+	}
+	l.print(LevelDebug, message, stringFields(properties))
+}
 func (l *Logger) PrintInfo(message string, properties map[string]string) {
-	l.print(LevelInfo, message, properties)
+	l.print(LevelInfo, message, stringFields(properties))
+}
+func (l *Logger) PrintWarn(message string, properties map[string]string) {
+	l.print(LevelWarn, message, stringFields(properties))
 }
 func (l *Logger) PrintError(err error, properties map[string]string) {
-	l.print(LevelError, err.Error(), properties)
+	l.print(LevelError, err.Error(), stringFields(properties))
 }
 func (l *Logger) PrintFatal(err error, properties map[string]string) {
-	l.print(LevelFatal, err.Error(), properties)
+	l.print(LevelFatal, err.Error(), stringFields(properties))
 	os.Exit(1) // For entries at the FATAL level, we also terminate the application.
 }
 
-func (l *Logger) print(level Level, message string, properties map[string]string) (int, error) {
-	if level < l.minLevel {
+// Log writes an entry with typed fields. Unlike PrintFatal, it never exits.
+func (l *Logger) Log(level Level, message string, fields ...Field) {
+	if !l.Enabled(level) {
+		return
+	}
+	l.print(level, message, fieldMap(fields))
+}
+
+func (l *Logger) print(level Level, message string, properties map[string]any) (int, error) {
+	if !l.Enabled(level) {
+		return 0, nil
+	}
+	return l.write(level, message, properties)
+}
+
+// write is print without the level check.
+func (l *Logger) write(level Level, message string, properties map[string]any) (int, error) {
+	if s := l.sampler.Load(); s != nil && !s.allow(level, message) {
 		return 0, nil
 	}
 
+	if policy := l.redact.Load(); policy != nil {
+		message = policy.redactString(message)
+		properties = policy.redactProperties(properties)
+	}
+
 	aux := struct {
-		Level      string            `json:"level"`
-		Time       string            `json:"time"`
-		Message    string            `json:"message"`
-		Properties map[string]string `json:"properties,omitempty"`
-		Trace      string            `json:"trace,omitempty"`
+		Level      string         `json:"level"`
+		Time       string         `json:"time"`
+		Message    string         `json:"message"`
+		Properties map[string]any `json:"properties,omitempty"`
+		Trace      string         `json:"trace,omitempty"`
 	}{
 		Level:      level.String(),
 		Time:       time.Now().UTC().Format(time.RFC3339),
 		Message:    message,
 		Properties: properties,
 	}
-	// Include a stack trace for entries at the ERROR and FATAL levels.
-	if level >= LevelError {
+	// Include a stack trace for entries at or above the stack level.
+	if level >= Level(l.stackLevel.Load()) {
 		aux.Trace = string(debug.Stack())
 	}
 	// Declare a line variable for holding the actual log entry text.
@@ -100,3 +186,14 @@ func (l *Logger) print(level Level, message string, properties map[string]string
 func (l *Logger) Write(message []byte) (n int, err error) {
 	return l.print(LevelError, string(message), nil)
 }
+
+func stringFields(properties map[string]string) map[string]any {
+	if len(properties) == 0 {
+		return nil
+	}
+	m := make(map[string]any, len(properties))
+	for k, v := range properties {
+		m[k] = v
+	}
+	return m
+}
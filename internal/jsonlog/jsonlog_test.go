@@ -0,0 +1,42 @@
+package jsonlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestParseLevel(t *testing.T) {
+	for l := LevelDebug; l <= LevelOff; l++ {
+		for _, name := range []string{l.String(), strings.ToLower(l.String())} {
+			got, err := ParseLevel(name)
+			if err != nil || got != l {
+				t.Errorf("ParseLevel(%q) = %s, %v, want %s", name, got, err, l)
+			}
+		}
+	}
+
+	for _, name := range []string{"", "TRACE", "warning", "2"} {
+		if _, err := ParseLevel(name); err == nil {
+			t.Errorf("ParseLevel(%q) succeeded, want an error", name)
+		}
+	}
+}
+
+func TestSetLevel(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out, LevelInfo)
+
+	l.PrintDebug("hidden", nil)
+	l.SetLevel(LevelDebug)
+	l.PrintDebug("shown", nil)
+	l.SetLevel(LevelOff)
+	l.PrintError(bytes.ErrTooLarge, nil)
+
+	if got := out.String(); strings.Contains(got, "hidden") || !strings.Contains(got, "shown") || strings.Count(got, "\n") != 1 {
+		t.Fatalf("entries:\n%s\nwant only the one written at DEBUG", got)
+	}
+	if l.Level() != LevelOff || l.Enabled(LevelFatal) {
+		t.Fatalf("Level = %s, want OFF with nothing enabled", l.Level())
+	}
+}
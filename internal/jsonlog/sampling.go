@@ -0,0 +1,81 @@
+package jsonlog
+
+import (
+	"hash/fnv"
+	"sync/atomic"
+	"time"
+)
+
+// SamplingConfig limits how often one message is written: within every Interval, the
+// first First entries with the same level and message are written, then every
+// Thereafter-th one. Entries at ERROR and above are never sampled.
+type SamplingConfig struct {
+	Interval   time.Duration
+	First      int
+	Thereafter int
+}
+
+// sampleBuckets bounds the memory used for counting; messages hashing to the same
+// bucket share a budget, which only makes sampling a little stricter.
+const sampleBuckets = 4096
+
+type sampler struct {
+	cfg      SamplingConfig
+	counters [sampleBuckets]sampleCounter
+	dropped  atomic.Uint64
+}
+
+type sampleCounter struct {
+	resetAt atomic.Int64
+	count   atomic.Uint64
+}
+
+// SetSampling enables sampling of entries below ERROR; nil or a zero Interval turns it
+// off. Counts start over on every call.
+func (l *Logger) SetSampling(cfg *SamplingConfig) {
+	if cfg == nil || cfg.Interval <= 0 {
+		l.sampler.Store(nil)
+		return
+	}
+	l.sampler.Store(&sampler{cfg: *cfg})
+}
+
+// Dropped returns the number of entries left out by sampling since it was last set.
+func (l *Logger) Dropped() uint64 {
+	if s := l.sampler.Load(); s != nil {
+		return s.dropped.Load()
+	}
+	return 0
+}
+
+func (s *sampler) allow(level Level, message string) bool {
+	if level >= LevelError {
+		return true
+	}
+
+	h := fnv.New32a()
+	h.Write([]byte{byte(level)})
+	h.Write([]byte(message))
+	n := s.counters[h.Sum32()%sampleBuckets].inc(time.Now(), s.cfg.Interval)
+
+	if n <= uint64(s.cfg.First) {
+		return true
+	}
+	if s.cfg.Thereafter > 0 && (n-uint64(s.cfg.First))%uint64(s.cfg.Thereafter) == 0 {
+		return true
+	}
+	s.dropped.Add(1)
+	return false
+}
+
+// inc counts one entry in the current interval. Two entries racing at the start of an
+// interval may both reset the count, which at worst lets one extra entry through.
+func (c *sampleCounter) inc(now time.Time, interval time.Duration) uint64 {
+	t := now.UnixNano()
+	if resetAt := c.resetAt.Load(); t < resetAt {
+		return c.count.Add(1)
+	}
+	c.count.Store(1)
+	c.resetAt.Store(t + int64(interval))
+	return 1
+}
@@ -0,0 +1,63 @@
+package jsonlog
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSampling(t *testing.T) {
+	var out bytes.Buffer
+	l := New(&out, LevelInfo)
+	l.SetSampling(&SamplingConfig{Interval: time.Hour, First: 2, Thereafter: 3})
+
+	for i := range 8 {
+		l.Log(LevelInfo, "cache miss", Int("n", i+1))
+	}
+	l.PrintInfo("toy added", nil)
+	for range 5 {
+		l.PrintError(bytes.ErrTooLarge, nil)
+	}
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	var misses []string
+	for _, line := range lines {
+		if strings.Contains(line, "cache miss") {
+			misses = append(misses, line[strings.Index(line, `"n":`):])
+		}
+	}
+	// The first two, then every third one after them.
+	want := []string{`"n":1}}`, `"n":2}}`, `"n":5}}`, `"n":8}}`}
+	if strings.Join(misses, " ") != strings.Join(want, " ") {
+		t.Errorf("sampled cache misses %v, want %v", misses, want)
+	}
+	if strings.Count(out.String(), "toy added") != 1 {
+		t.Error("another message shared the budget of cache miss")
+	}
+	if got := strings.Count(out.String(), `"level":"ERROR"`); got != 5 {
+		t.Errorf("%d ERROR entries written, want all 5", got)
+	}
+	if got := l.Dropped(); got != 4 {
+		t.Errorf("Dropped = %d, want 4", got)
+	}
+
+	l.SetSampling(nil)
+	if l.Dropped() != 0 {
+		t.Error("Dropped not reset when sampling was turned off")
+	}
+}
+
+func TestSampleCounterResetsEveryInterval(t *testing.T) {
+	var c sampleCounter
+	now := time.Unix(1_700_000_000, 0)
+
+	for want := uint64(1); want <= 3; want++ {
+		if got := c.inc(now, time.Second); got != want {
+			t.Fatalf("inc = %d, want %d", got, want)
+		}
+	}
+	if got := c.inc(now.Add(time.Second), time.Second); got != 1 {
+		t.Fatalf("inc in the next interval = %d, want 1", got)
+	}
+}
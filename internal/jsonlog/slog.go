@@ -0,0 +1,171 @@
+package jsonlog
+
+import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"time"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// SlogHandler writes slog records through a Logger, in the same JSON shape as its
+// other entries: attributes become properties and groups nested objects.
+type SlogHandler struct {
+	log    *Logger
+	groups []string
+	attrs  map[string]any
+}
+
+// SlogHandler returns a slog.Handler writing to l, so that slog.New(l.SlogHandler())
+// logs like l does, with its level, redaction and sampling.
+func (l *Logger) SlogHandler() *SlogHandler {
+	return &SlogHandler{log: l}
+}
+
+// fromSlog maps the slog levels onto ours; levels in between round down and anything
+// above ERROR stays ERROR.
+func fromSlog(level slog.Level) Level {
+	switch {
+	case level < slog.LevelInfo:
+		return LevelDebug
+	case level < slog.LevelWarn:
+		return LevelInfo
+	case level < slog.LevelError:
+		return LevelWarn
+	default:
+		return LevelError
+	}
+}
+
+func (h *SlogHandler) Enabled(_ context.Context, level slog.Level) bool {
+	return h.log.Enabled(fromSlog(level))
+}
+
+func (h *SlogHandler) Handle(ctx context.Context, r slog.Record) error {
+	properties := cloneProperties(h.attrs)
+	if r.NumAttrs() > 0 {
+		if properties == nil {
+			properties = make(map[string]any)
+		}
+		target := groupMap(properties, h.groups)
+		r.Attrs(func(a slog.Attr) bool {
+			addAttr(target, a)
+			return true
+		})
+	}
+	_, err := h.log.print(fromSlog(r.Level), r.Message, withContext(ctx, properties))
+	return err
+}
+
+func (h *SlogHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	if len(attrs) == 0 {
+		return h
+	}
+	properties := cloneProperties(h.attrs)
+	if properties == nil {
+		properties = make(map[string]any)
+	}
+	target := groupMap(properties, h.groups)
+	for _, a := range attrs {
+		addAttr(target, a)
+	}
+	return &SlogHandler{log: h.log, groups: h.groups, attrs: properties}
+}
+
+func (h *SlogHandler) WithGroup(name string) slog.Handler {
+	if name == "" {
+		return h
+	}
+	groups := make([]string, len(h.groups), len(h.groups)+1)
+	copy(groups, h.groups)
+	return &SlogHandler{log: h.log, groups: append(groups, name), attrs: h.attrs}
+}
+
+// groupMap returns the object of properties the attributes of groups go into,
+// creating it when needed.
+func groupMap(properties map[string]any, groups []string) map[string]any {
+	for _, g := range groups {
+		next, ok := properties[g].(map[string]any)
+		if !ok {
+			next = make(map[string]any)
+			properties[g] = next
+		}
+		properties = next
+	}
+	return properties
+}
+
+// addAttr follows the slog.Handler rules: empty attributes are dropped and groups
+// without a key are inlined.
+func addAttr(properties map[string]any, a slog.Attr) {
+	a.Value = a.Value.Resolve()
+	if a.Equal(slog.Attr{}) {
+		return
+	}
+	if a.Value.Kind() == slog.KindGroup {
+		attrs := a.Value.Group()
+		if len(attrs) == 0 {
+			return
+		}
+		target := properties
+		if a.Key != "" {
+			target = groupMap(properties, []string{a.Key})
+		}
+		for _, ga := range attrs {
+			addAttr(target, ga)
+		}
+		return
+	}
+	properties[a.Key] = slogValue(a.Value)
+}
+
+// slogValue converts v the way the Field helpers do, so both APIs write the same JSON.
+func slogValue(v slog.Value) any {
+	switch v.Kind() {
+	case slog.KindDuration:
+		return v.Duration().String()
+	case slog.KindTime:
+		return v.Time().UTC().Format(time.RFC3339Nano)
+	case slog.KindAny:
+		switch a := v.Any().(type) {
+		case error:
+			return a.Error()
+		case proto.Message:
+			return protoValue(a)
+		}
+		return v.Any()
+	default:
+		return v.Any()
+	}
+}
+
+// cloneProperties copies the nested objects too, as attributes get added to them.
+func cloneProperties(properties map[string]any) map[string]any {
+	if properties == nil {
+		return nil
+	}
+	out := make(map[string]any, len(properties))
+	for k, v := range properties {
+		if m, ok := v.(map[string]any); ok {
+			v = cloneProperties(m)
+		}
+		out[k] = v
+	}
+	return out
+}
+
+// protoValue turns m into nested maps, as protojson writes it, so redaction sees the
+// fields of logged messages.
+func protoValue(m proto.Message) any {
+	raw, err := protojson.Marshal(m)
+	if err != nil {
+		return err.Error()
+	}
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return err.Error()
+	}
+	return v
+}
@@ -0,0 +1,71 @@
+package notify
+
+import "sync"
+
+// Hub fans out "cart changed" signals to the watchers of a user. Signals carry no
+// payload and coalesce: a watcher that is still busy with the previous change gets a
+// single pending signal and re-reads the cart once.
+type Hub struct {
+	mu       sync.Mutex
+	watchers map[int64]map[chan struct{}]struct{}
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		watchers: make(map[int64]map[chan struct{}]struct{}),
+	}
+}
+
+// Subscribe returns a channel signalled on every change of userID's cart and a
+// function that must be called to stop watching.
+func (h *Hub) Subscribe(userID int64) (<-chan struct{}, func()) {
+	ch := make(chan struct{}, 1)
+
+	h.mu.Lock()
+	if h.watchers[userID] == nil {
+		h.watchers[userID] = make(map[chan struct{}]struct{})
+	}
+	h.watchers[userID][ch] = struct{}{}
+	h.mu.Unlock()
+
+	var once sync.Once
+	return ch, func() {
+		once.Do(func() {
+			h.mu.Lock()
+			defer h.mu.Unlock()
+			delete(h.watchers[userID], ch)
+			if len(h.watchers[userID]) == 0 {
+				delete(h.watchers, userID)
+			}
+		})
+	}
+}
+
+func (h *Hub) Publish(userID int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for ch := range h.watchers[userID] {
+		signal(ch)
+	}
+}
+
+// PublishAll signals every watcher, e.g. after a lost connection to the change feed
+// when individual notifications may have been missed.
+func (h *Hub) PublishAll() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	for _, chans := range h.watchers {
+		for ch := range chans {
+			signal(ch)
+		}
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket: Rate tokens are added per second up to Burst.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Store keeps the buckets. Take consumes one token from the bucket under key and,
+// when the bucket is empty, reports how long until a token is available.
+type Store interface {
+	Take(ctx context.Context, key string, limit Limit) (allowed bool, retryAfter time.Duration, err error)
+}
+
+// Limiter applies per-method limits to per-user buckets.
+type Limiter struct {
+	store        Store
+	limits       map[string]Limit
+	defaultLimit *Limit
+	// FailOpen lets requests through when the store errors, e.g. Redis is down.
+	failOpen bool
+}
+
+func New(store Store, limits map[string]Limit, failOpen bool) *Limiter {
+	l := &Limiter{
+		store:    store,
+		limits:   make(map[string]Limit, len(limits)),
+		failOpen: failOpen,
+	}
+	for method, limit := range limits {
+		if method == "default" {
+			limit := limit
+			l.defaultLimit = &limit
+			continue
+		}
+		l.limits[method] = limit
+	}
+	return l
+}
+
+// Allow reports whether subject may call method now. Methods without a configured
+// limit and no default limit are never limited.
+func (l *Limiter) Allow(ctx context.Context, method, subject string) (bool, time.Duration, error) {
+	limit, ok := l.limits[method]
+	if !ok {
+		if l.defaultLimit == nil {
+			return true, 0, nil
+		}
+		limit = *l.defaultLimit
+	}
+
+	allowed, retryAfter, err := l.store.Take(ctx, subject+"|"+method, limit)
+	if err != nil {
+		return l.failOpen, 0, err
+	}
+	return allowed, retryAfter, nil
+}
+
+// ParseLimits parses a comma separated list of method=rate:burst pairs, e.g.
+// "/cart.Cart/AddToCart=2:10,default=20:40". Rate is in requests per second.
+func ParseLimits(s string) (map[string]Limit, error) {
+	limits := make(map[string]Limit)
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+
+		method, spec, ok := strings.Cut(part, "=")
+		if !ok {
+			return nil, fmt.Errorf("ratelimit: %q: expected method=rate:burst", part)
+		}
+		rateStr, burstStr, ok := strings.Cut(spec, ":")
+		if !ok {
+			return nil, fmt.Errorf("ratelimit: %q: expected method=rate:burst", part)
+		}
+
+		rate, err := strconv.ParseFloat(rateStr, 64)
+		if err != nil || rate <= 0 || math.IsInf(rate, 0) {
+			return nil, fmt.Errorf("ratelimit: %q: invalid rate", part)
+		}
+		burst, err := strconv.Atoi(burstStr)
+		if err != nil || burst < 1 {
+			return nil, fmt.Errorf("ratelimit: %q: invalid burst", part)
+		}
+
+		limits[strings.TrimSpace(method)] = Limit{Rate: rate, Burst: burst}
+	}
+	return limits, nil
+}
@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"cartService/internal/cache"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// tokenBucketScript refills and takes from a bucket stored as a hash in one atomic
+// step. It reads the clock with TIME so replicas with skewed clocks share one view.
+const tokenBucketScript = `
+local rate = tonumber(ARGV[1])
+local burst = tonumber(ARGV[2])
+local t = redis.call('TIME')
+local now = tonumber(t[1]) * 1000 + math.floor(tonumber(t[2]) / 1000)
+
+local state = redis.call('HMGET', KEYS[1], 'tokens', 'ts')
+local tokens = tonumber(state[1]) or burst
+local ts = tonumber(state[2]) or now
+
+tokens = math.min(burst, tokens + (now - ts) / 1000 * rate)
+
+local allowed = 0
+local retry = 0
+if tokens >= 1 then
+  tokens = tokens - 1
+  allowed = 1
+else
+  retry = math.ceil((1 - tokens) / rate * 1000)
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'ts', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil(burst / rate * 1000) + 1000)
+return {allowed, retry}
+`
+
+// RedisStore keeps buckets in a Redis compatible server so every replica enforces the
+// same limits.
+type RedisStore struct {
+	client *cache.Redis
+	prefix string
+}
+
+func NewRedisStore(client *cache.Redis) *RedisStore {
+	return &RedisStore{
+		client: client,
+		prefix: "ratelimit:",
+	}
+}
+
+func (s *RedisStore) Take(ctx context.Context, key string, limit Limit) (bool, time.Duration, error) {
+	reply, err := s.client.Do(ctx, "EVAL", tokenBucketScript, "1", s.prefix+key,
+		strconv.FormatFloat(limit.Rate, 'f', -1, 64), strconv.Itoa(limit.Burst))
+	if err != nil {
+		return false, 0, fmt.Errorf("%s: %w", "ratelimit.RedisStore.Take", err)
+	}
+
+	values, ok := reply.([]any)
+	if !ok || len(values) != 2 {
+		return false, 0, fmt.Errorf("ratelimit.RedisStore.Take: unexpected reply %v", reply)
+	}
+	allowed, _ := values[0].(int64)
+	retryMs, _ := values[1].(int64)
+
+	return allowed == 1, time.Duration(retryMs) * time.Millisecond, nil
+}
@@ -0,0 +1,130 @@
+package admin
+
+import (
+	"cartService/internal/audit"
+	"cartService/internal/clients/breaker"
+	"cartService/internal/clients/toys/grpc"
+	"cartService/internal/contextkeys"
+	"cartService/internal/data"
+	"cartService/internal/jsonlog"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+	"unicode"
+
+	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
+	"github.com/spacecowboytobykty123/toysProto/gen/go/toys"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// Admin lets support staff inspect and edit the cart of any user. Unlike cart.Carts it
+// takes the target user explicitly and skips the subscription check; every call is
+// written to the audit log.
+type Admin struct {
+	log          *jsonlog.Logger
+	cartProvider cartProvider
+	toyClient    *grpc.ToyClient
+	audit        *audit.Logger
+}
+
+type cartProvider interface {
+	AddToCart(ctx context.Context, toy data.CartItem, userID int64) (cart_v1_crt.OperationStatus, string)
+	DelFromCart(ctx context.Context, toyId int64, userID int64) (cart_v1_crt.OperationStatus, string)
+	ClearCart(ctx context.Context, userID int64) (cart_v1_crt.OperationStatus, string)
+	GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32)
+}
+
+func New(log *jsonlog.Logger, cartProvider cartProvider, toyClient *grpc.ToyClient, auditLog *audit.Logger) *Admin {
+	return &Admin{
+		log:          log,
+		cartProvider: cartProvider,
+		toyClient:    toyClient,
+		audit:        auditLog,
+	}
+}
+
+func (a Admin) GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32) {
+	toysList, totalItems, qty := a.cartProvider.GetCart(ctx, userID)
+
+	// The storages report a failed read as a nil cart.
+	opStatus := cart_v1_crt.OperationStatus_STATUS_OK
+	if toysList == nil {
+		opStatus = cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR
+	}
+	a.record(ctx, "get_cart", userID, opStatus.String(), map[string]string{
+		"total_items": strconv.Itoa(int(totalItems)),
+	})
+	return toysList, totalItems, qty
+}
+
+func (a Admin) AddToCart(ctx context.Context, userID int64, toy data.CartItem) (cart_v1_crt.OperationStatus, string) {
+	details := map[string]string{
+		"toy_id":   strconv.FormatInt(toy.ToyID, 10),
+		"quantity": strconv.Itoa(int(toy.Quantity)),
+	}
+
+	toyResp, err := a.toyClient.GetToy(ctx, toy.ToyID)
+	if errors.Is(err, breaker.ErrUpstreamUnavailable) {
+		a.record(ctx, "add_to_cart", userID, cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR.String(), details)
+		return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "toys service is unavailable, try again later"
+	}
+	if toyResp.Status != toys.Status_STATUS_OK {
+		a.record(ctx, "add_to_cart", userID, cart_v1_crt.OperationStatus_STATUS_INVALID_TOY.String(), details)
+		return cart_v1_crt.OperationStatus_STATUS_INVALID_TOY, "toy is not exist in database!"
+	}
+
+	opStatus, msg := a.cartProvider.AddToCart(ctx, toy, userID)
+	a.record(ctx, "add_to_cart", userID, opStatus.String(), details)
+	return opStatus, msg
+}
+
+func (a Admin) DelFromCart(ctx context.Context, userID int64, toyId int64) (cart_v1_crt.OperationStatus, string) {
+	opStatus, msg := a.cartProvider.DelFromCart(ctx, toyId, userID)
+	a.record(ctx, "del_from_cart", userID, opStatus.String(), map[string]string{
+		"toy_id": strconv.FormatInt(toyId, 10),
+	})
+	return opStatus, msg
+}
+
+func (a Admin) ClearCart(ctx context.Context, userID int64) (cart_v1_crt.OperationStatus, string) {
+	opStatus, msg := a.cartProvider.ClearCart(ctx, userID)
+	a.record(ctx, "clear_cart", userID, opStatus.String(), nil)
+	return opStatus, msg
+}
+
+// Rejected audits a call to action refused before it reached the cart, with the gRPC
+// code of err as its status, e.g. PERMISSION_DENIED for a caller who is not an admin.
+// targetUser is 0 when the call named no valid target.
+func (a Admin) Rejected(ctx context.Context, action string, targetUser int64, err error) {
+	st := status.Convert(err)
+	a.record(ctx, action, targetUser, codeName(st.Code()), map[string]string{
+		"reason": st.Message(),
+	})
+}
+
+// codeName spells code as in the gRPC spec, e.g. PERMISSION_DENIED.
+func codeName(code codes.Code) string {
+	var b strings.Builder
+	prev := ' '
+	for _, r := range code.String() {
+		if unicode.IsUpper(r) && unicode.IsLower(prev) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToUpper(r))
+		prev = r
+	}
+	return b.String()
+}
+
+func (a Admin) record(ctx context.Context, action string, targetUser int64, status string, details map[string]string) {
+	actor, _ := ctx.Value(contextkeys.UserIDKey).(int64)
+
+	if err := a.audit.Record(actor, action, targetUser, status, details); err != nil {
+		a.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "admin.record",
+			"action": action,
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package admin
+
+import (
+	"bytes"
+	"cartService/internal/audit"
+	"cartService/internal/contextkeys"
+	"cartService/internal/data"
+	"cartService/internal/jsonlog"
+	"cartService/storage/memory"
+	"context"
+	"encoding/json"
+	"io"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// failingReads is a storage whose reads fail, reported as a nil cart.
+type failingReads struct {
+	*memory.Storage
+}
+
+func (failingReads) GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32) {
+	return nil, 0, 0
+}
+
+func lastEntry(t *testing.T, out *bytes.Buffer) audit.Entry {
+	t.Helper()
+	lines := bytes.Split(bytes.TrimSpace(out.Bytes()), []byte("\n"))
+	var entry audit.Entry
+	if err := json.Unmarshal(lines[len(lines)-1], &entry); err != nil {
+		t.Fatalf("audit line %q: %v", lines[len(lines)-1], err)
+	}
+	return entry
+}
+
+func TestGetCartAuditsOutcome(t *testing.T) {
+	ctx := context.WithValue(context.Background(), contextkeys.UserIDKey, int64(7))
+	log := jsonlog.New(io.Discard, jsonlog.LevelOff)
+
+	tests := []struct {
+		name    string
+		storage cartProvider
+		want    string
+	}{
+		{"read", memory.New(), "STATUS_OK"},
+		{"failed read", failingReads{memory.New()}, "STATUS_INTERNAL_ERROR"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			a := New(log, tt.storage, nil, audit.New(&out))
+
+			a.GetCart(ctx, 42)
+
+			entry := lastEntry(t, &out)
+			if entry.Action != "get_cart" || entry.Status != tt.want || entry.Actor != 7 || entry.TargetUser != 42 {
+				t.Fatalf("audited %+v, want get_cart by 7 on 42 with %s", entry, tt.want)
+			}
+		})
+	}
+}
+
+func TestRejected(t *testing.T) {
+	ctx := context.WithValue(context.Background(), contextkeys.UserIDKey, int64(3))
+
+	tests := []struct {
+		name   string
+		target int64
+		err    error
+		want   string
+	}{
+		{"not an admin", 42, status.Error(codes.PermissionDenied, "admin role required"), "PERMISSION_DENIED"},
+		{"invalid target", 0, status.Error(codes.InvalidArgument, "invalid x-target-user-id"), "INVALID_ARGUMENT"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			a := New(jsonlog.New(io.Discard, jsonlog.LevelOff), memory.New(), nil, audit.New(&out))
+
+			a.Rejected(ctx, "clear_cart", tt.target, tt.err)
+
+			entry := lastEntry(t, &out)
+			if entry.Action != "clear_cart" || entry.Status != tt.want || entry.Actor != 3 || entry.TargetUser != tt.target {
+				t.Fatalf("audited %+v, want a rejected clear_cart by 3 on %d with %s", entry, tt.target, tt.want)
+			}
+			if entry.Details["reason"] != status.Convert(tt.err).Message() {
+				t.Fatalf("reason %q, want the error message", entry.Details["reason"])
+			}
+		})
+	}
+}
+
+func TestCodeName(t *testing.T) {
+	for code, want := range map[codes.Code]string{
+		codes.OK:                "OK",
+		codes.InvalidArgument:   "INVALID_ARGUMENT",
+		codes.PermissionDenied:  "PERMISSION_DENIED",
+		codes.ResourceExhausted: "RESOURCE_EXHAUSTED",
+	} {
+		if got := codeName(code); got != want {
+			t.Errorf("codeName(%s) = %q, want %q", code, got, want)
+		}
+	}
+}
@@ -1,17 +1,21 @@
 package cart
 
 import (
+	"cartService/internal/clients/breaker"
 	subsgrpc "cartService/internal/clients/subscriptions/grpc"
 	"cartService/internal/clients/toys/grpc"
 	"cartService/internal/contextkeys"
 	"cartService/internal/data"
 	"cartService/internal/jsonlog"
 	"context"
+	"errors"
 	"fmt"
 	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
 	subs "github.com/spacecowboytobykty123/subsProto/gen/go/subscription"
 	"github.com/spacecowboytobykty123/toysProto/gen/go/toys"
+	grpc2 "google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/status"
 	"time"
 )
@@ -20,6 +24,7 @@ type Carts struct {
 	log          *jsonlog.Logger
 	cartProvider cartProvider
 	tokenTTL     time.Duration
+	subsPolicy   SubsPolicy
 	subsClient   *subsgrpc.Client
 	toyClient    *grpc.ToyClient
 }
@@ -28,13 +33,15 @@ type cartProvider interface {
 	AddToCart(ctx context.Context, toy data.CartItem, userID int64) (cart_v1_crt.OperationStatus, string)
 	DelFromCart(ctx context.Context, toyId int64, userID int64) (cart_v1_crt.OperationStatus, string)
 	GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32)
+	Watch(ctx context.Context, userID int64) (<-chan struct{}, func())
 }
 
-func New(log *jsonlog.Logger, cartProvider cartProvider, tokenTTL time.Duration, subsClient *subsgrpc.Client, toyClient *grpc.ToyClient) *Carts {
+func New(log *jsonlog.Logger, cartProvider cartProvider, tokenTTL time.Duration, subsPolicy SubsPolicy, subsClient *subsgrpc.Client, toyClient *grpc.ToyClient) *Carts {
 	return &Carts{
 		log:          log,
 		cartProvider: cartProvider,
 		tokenTTL:     tokenTTL,
+		subsPolicy:   subsPolicy,
 		subsClient:   subsClient,
 		toyClient:    toyClient,
 	}
@@ -46,14 +53,20 @@ func (c Carts) AddToCart(ctx context.Context, toy data.CartItem) (cart_v1_crt.Op
 		return cart_v1_crt.OperationStatus_STATUS_INVALID_USER, "invalid user"
 	}
 
-	subsResp := c.subsClient.CheckSubscription(ctx, userID)
-	if subsResp.SubStatus != subs.Status_STATUS_SUBSCRIBED {
+	subscribed, err := c.checkSubscription(ctx, OpAddToCart, userID)
+	if err != nil {
+		return c.upstreamUnavailable(ctx, "cart.AddToCart", err)
+	}
+	if !subscribed {
 		return cart_v1_crt.OperationStatus_STATUS_INVALID_USER, "user is not subscribed!"
 	}
 
-	toyResp := c.toyClient.GetToy(ctx, toy.ToyID)
+	toyResp, err := c.toyClient.GetToy(ctx, toy.ToyID)
+	if errors.Is(err, breaker.ErrUpstreamUnavailable) {
+		return c.upstreamUnavailable(ctx, "cart.AddToCart", err)
+	}
 	if toyResp.Status != toys.Status_STATUS_OK {
-		c.log.PrintError(fmt.Errorf("toy is not exist!"), map[string]string{
+		c.log.PrintErrorContext(ctx, fmt.Errorf("toy is not exist!"), map[string]string{
 			"method": "cart.addtocart",
 		})
 		return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "toy is not exist in database!"
@@ -65,6 +78,7 @@ func (c Carts) AddToCart(ctx context.Context, toy data.CartItem) (cart_v1_crt.Op
 		return opStatus, msg
 	}
 
+	itemsAdded.Add(float64(toy.Quantity))
 	return opStatus, msg
 }
 
@@ -74,8 +88,11 @@ func (c Carts) DelFromCart(ctx context.Context, toyId int64) (cart_v1_crt.Operat
 		return cart_v1_crt.OperationStatus_STATUS_INVALID_USER, "invalid user"
 	}
 
-	subsResp := c.subsClient.CheckSubscription(ctx, userID)
-	if subsResp.SubStatus != subs.Status_STATUS_SUBSCRIBED {
+	subscribed, err := c.checkSubscription(ctx, OpDelFromCart, userID)
+	if err != nil {
+		return c.upstreamUnavailable(ctx, "cart.DelFromCart", err)
+	}
+	if !subscribed {
 		return cart_v1_crt.OperationStatus_STATUS_INVALID_USER, "user is not subscribed!"
 	}
 	opStatus, msg := c.cartProvider.DelFromCart(ctx, toyId, userID)
@@ -84,21 +101,28 @@ func (c Carts) DelFromCart(ctx context.Context, toyId int64) (cart_v1_crt.Operat
 		return opStatus, msg
 	}
 
+	itemsRemoved.Inc()
 	return opStatus, msg
 }
 
 func (c Carts) GetCart(ctx context.Context) ([]*data.CartItem, int32, int32) {
 	userID, err := getUserFromContext(ctx)
 	if err != nil {
-		c.log.PrintError(status.Error(codes.Unauthenticated, "failed to authenticate user"), map[string]string{
+		c.log.PrintErrorContext(ctx, status.Error(codes.Unauthenticated, "failed to authenticate user"), map[string]string{
 			"method": "cart.GetCart",
 		})
 		return []*data.CartItem{}, 0, 0
 	}
 
-	subsResp := c.subsClient.CheckSubscription(ctx, userID)
-	if subsResp.SubStatus != subs.Status_STATUS_SUBSCRIBED {
-		c.log.PrintError(status.Error(codes.PermissionDenied, "user is not subscribed"), map[string]string{
+	subscribed, err := c.checkSubscription(ctx, OpGetCart, userID)
+	if err != nil {
+		c.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "cart.GetCart",
+		})
+		return []*data.CartItem{}, 0, 0
+	}
+	if !subscribed {
+		c.log.PrintErrorContext(ctx, status.Error(codes.PermissionDenied, "user is not subscribed"), map[string]string{
 			"method": "cart.GetCart",
 		})
 		return []*data.CartItem{}, 0, 0
@@ -106,15 +130,143 @@ func (c Carts) GetCart(ctx context.Context) ([]*data.CartItem, int32, int32) {
 
 	toysList, total_items, qty := c.cartProvider.GetCart(ctx, userID)
 	if toysList == nil {
-		c.log.PrintError(status.Error(codes.NotFound, "failed to fetch toys"), map[string]string{
+		c.log.PrintErrorContext(ctx, status.Error(codes.NotFound, "failed to fetch toys"), map[string]string{
 			"method": "cart.getCart",
 		})
 		return nil, 0, 0
 	}
 
+	cartSize.Observe(float64(total_items))
 	return toysList, total_items, qty
 }
 
+// watchRecheckInterval is how often an open WatchCart stream checks that the user is
+// still subscribed.
+const watchRecheckInterval = time.Minute
+
+var errTokenExpired = status.Error(codes.Unauthenticated, "token expired")
+
+// WatchCart sends the user's cart right away and then again after every change until
+// ctx is done or send fails. The stream ends when the caller's token expires, the
+// user is no longer subscribed or the cart can't be read.
+func (c Carts) WatchCart(ctx context.Context, send func(toys []*data.CartItem, totalItems int32, totalQty int32) error) error {
+	userID, err := getUserFromContext(ctx)
+	if err != nil {
+		return err
+	}
+
+	if exp, ok := ctx.Value(contextkeys.ExpiresAtKey).(time.Time); ok {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadlineCause(ctx, exp, errTokenExpired)
+		defer cancel()
+	}
+
+	if err := c.checkWatchSubscription(ctx, userID); err != nil {
+		return err
+	}
+
+	// Subscribe before the first read so a change made in between is not lost.
+	changes, stop := c.cartProvider.Watch(ctx, userID)
+	defer stop()
+
+	recheck := time.NewTicker(watchRecheckInterval)
+	defer recheck.Stop()
+
+	for {
+		toysList, totalItems, qty := c.cartProvider.GetCart(ctx, userID)
+		if toysList == nil {
+			return status.Error(codes.Unavailable, "failed to fetch cart")
+		}
+		if err := send(toysList, totalItems, qty); err != nil {
+			return err
+		}
+
+		if err := c.waitForChange(ctx, userID, changes, recheck.C); err != nil {
+			return err
+		}
+	}
+}
+
+// waitForChange returns once changes is signalled, re-checking the subscription on
+// every tick meanwhile.
+func (c Carts) waitForChange(ctx context.Context, userID int64, changes <-chan struct{}, recheck <-chan time.Time) error {
+	for {
+		select {
+		case <-ctx.Done():
+			if cause := context.Cause(ctx); errors.Is(cause, errTokenExpired) {
+				return cause
+			}
+			return ctx.Err()
+		case <-recheck:
+			if err := c.checkWatchSubscription(ctx, userID); err != nil {
+				return err
+			}
+		case <-changes:
+			return nil
+		}
+	}
+}
+
+func (c Carts) checkWatchSubscription(ctx context.Context, userID int64) error {
+	subscribed, err := c.checkSubscription(ctx, OpWatchCart, userID)
+	if err != nil {
+		return status.Error(codes.Unavailable, err.Error())
+	}
+	if !subscribed {
+		return status.Error(codes.PermissionDenied, "user is not subscribed")
+	}
+	return nil
+}
+
+// checkSubscription reports whether userID is subscribed. When the subscriptions
+// service can't answer, the policy of op decides: the call either goes ahead with the
+// response marked as degraded, or err is returned.
+func (c Carts) checkSubscription(ctx context.Context, op string, userID int64) (bool, error) {
+	subsResp, err := c.subsClient.CheckSubscription(ctx, userID)
+	if err == nil && subsResp.SubStatus != subs.Status_STATUS_INTERNAL_ERROR {
+		return subsResp.SubStatus == subs.Status_STATUS_SUBSCRIBED, nil
+	}
+	if err == nil {
+		err = errors.New("subscriptions service returned an internal error")
+	}
+
+	switch c.subsPolicy.mode(op) {
+	case FailOpen:
+		c.markDegraded(ctx, op, err)
+		return true, nil
+	case FailLastKnownGood:
+		if at, ok := c.subsClient.LastSubscribed(userID); ok && time.Since(at) <= c.subsPolicy.Grace {
+			c.markDegraded(ctx, op, err)
+			return true, nil
+		}
+	}
+	return false, err
+}
+
+func (c Carts) markDegraded(ctx context.Context, op string, err error) {
+	c.log.PrintErrorContext(ctx, err, map[string]string{
+		"method":    "cart.checkSubscription",
+		"operation": op,
+		"degraded":  "true",
+	})
+	// SetHeader only fails outside a gRPC handler; the flag is best effort.
+	_ = grpc2.SetHeader(ctx, metadata.Pairs(DegradedHeader, "subscription-unverified"))
+}
+
+// upstreamUnavailable answers calls that need a service that could not be reached,
+// instead of reporting the user as unsubscribed or the toy as missing.
+func (c Carts) upstreamUnavailable(ctx context.Context, method string, err error) (cart_v1_crt.OperationStatus, string) {
+	c.log.PrintErrorContext(ctx, err, map[string]string{
+		"method": method,
+	})
+
+	var unavailable *breaker.UnavailableError
+	if errors.As(err, &unavailable) {
+		return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, fmt.Sprintf("%s service is unavailable, try again later", unavailable.Service)
+	}
+	return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "service is unavailable, try again later"
+}
+
 func getUserFromContext(ctx context.Context) (int64, error) {
 	val := ctx.Value(contextkeys.UserIDKey)
 	userID, ok := val.(int64)
@@ -0,0 +1,24 @@
+package cart
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var (
+	itemsAdded = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cart_items_added_total",
+		Help: "Toy units added to carts by users.",
+	})
+
+	itemsRemoved = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "cart_items_removed_total",
+		Help: "Toys removed from carts by users.",
+	})
+
+	cartSize = promauto.NewHistogram(prometheus.HistogramOpts{
+		Name:    "cart_size_items",
+		Help:    "Distinct toys in a cart, observed each time a user reads it.",
+		Buckets: []float64{0, 1, 2, 3, 5, 10, 20, 50},
+	})
+)
@@ -0,0 +1,89 @@
+package cart
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// DegradedHeader is set on responses served without a confirmed subscription because
+// the subscriptions service could not be reached.
+const DegradedHeader = "x-cart-degraded"
+
+// FailMode decides what an operation does when the subscription check fails, as
+// opposed to the user being reported as not subscribed.
+type FailMode string
+
+const (
+	// FailOpen serves the call and marks the response as degraded.
+	FailOpen FailMode = "open"
+	// FailClosed rejects the call.
+	FailClosed FailMode = "closed"
+	// FailLastKnownGood serves the call, marked as degraded, if the user was seen
+	// subscribed within the grace window, and rejects it otherwise.
+	FailLastKnownGood FailMode = "last-known-good"
+)
+
+const (
+	OpGetCart     = "get_cart"
+	OpWatchCart   = "watch_cart"
+	OpAddToCart   = "add_to_cart"
+	OpDelFromCart = "del_from_cart"
+)
+
+type SubsPolicy struct {
+	Modes map[string]FailMode
+	// Grace is how old a last-known-good subscription may be for FailLastKnownGood.
+	Grace time.Duration
+}
+
+// DefaultSubsPolicy returns the policy used in every environment: reads fail open and
+// writes fall back to the last known status. Writes only fail open when configured so.
+func DefaultSubsPolicy() SubsPolicy {
+	return SubsPolicy{
+		Modes: map[string]FailMode{
+			OpGetCart:     FailOpen,
+			OpWatchCart:   FailOpen,
+			OpAddToCart:   FailLastKnownGood,
+			OpDelFromCart: FailLastKnownGood,
+		},
+		Grace: 15 * time.Minute,
+	}
+}
+
+// ParseModes overrides p's modes from "op=mode,op=mode", e.g.
+// "add_to_cart=closed,get_cart=open".
+func (p *SubsPolicy) ParseModes(s string) error {
+	if p.Modes == nil {
+		p.Modes = make(map[string]FailMode)
+	}
+	for _, part := range strings.Split(s, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		op, mode, ok := strings.Cut(part, "=")
+		if !ok {
+			return fmt.Errorf("cart.ParseModes: %q is not op=mode", part)
+		}
+		switch op {
+		case OpGetCart, OpWatchCart, OpAddToCart, OpDelFromCart:
+		default:
+			return fmt.Errorf("cart.ParseModes: unknown operation %q", op)
+		}
+		switch m := FailMode(mode); m {
+		case FailOpen, FailClosed, FailLastKnownGood:
+			p.Modes[op] = m
+		default:
+			return fmt.Errorf("cart.ParseModes: unknown fail mode %q", mode)
+		}
+	}
+	return nil
+}
+
+func (p SubsPolicy) mode(op string) FailMode {
+	if m, ok := p.Modes[op]; ok {
+		return m
+	}
+	return FailClosed
+}
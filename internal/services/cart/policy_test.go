@@ -0,0 +1,33 @@
+package cart
+
+import "testing"
+
+func TestDefaultSubsPolicyWritesNeverFailOpen(t *testing.T) {
+	p := DefaultSubsPolicy()
+	for _, op := range []string{OpAddToCart, OpDelFromCart} {
+		if got := p.mode(op); got != FailLastKnownGood {
+			t.Errorf("mode(%s) = %s, want %s", op, got, FailLastKnownGood)
+		}
+	}
+	for _, op := range []string{OpGetCart, OpWatchCart} {
+		if got := p.mode(op); got != FailOpen {
+			t.Errorf("mode(%s) = %s, want %s", op, got, FailOpen)
+		}
+	}
+}
+
+func TestParseModes(t *testing.T) {
+	p := DefaultSubsPolicy()
+	if err := p.ParseModes("add_to_cart=open, get_cart=closed"); err != nil {
+		t.Fatalf("ParseModes: %v", err)
+	}
+	if p.mode(OpAddToCart) != FailOpen || p.mode(OpGetCart) != FailClosed || p.mode(OpDelFromCart) != FailLastKnownGood {
+		t.Fatalf("modes = %v", p.Modes)
+	}
+
+	for _, bad := range []string{"add_to_cart", "checkout=open", "get_cart=sometimes"} {
+		if err := p.ParseModes(bad); err == nil {
+			t.Errorf("ParseModes(%q) succeeded, want an error", bad)
+		}
+	}
+}
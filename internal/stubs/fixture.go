@@ -0,0 +1,177 @@
+package stubs
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	subs "github.com/spacecowboytobykty123/subsProto/gen/go/subscription"
+	"github.com/spacecowboytobykty123/toysProto/gen/go/toys"
+	"google.golang.org/grpc/codes"
+	"gopkg.in/yaml.v3"
+)
+
+// Fixture scripts what the stub services answer.
+type Fixture struct {
+	Subscriptions Subscriptions `yaml:"subscriptions"`
+	Toys          Toys          `yaml:"toys"`
+}
+
+type Subscriptions struct {
+	Subscribed    []int64 `yaml:"subscribed"`
+	NotSubscribed []int64 `yaml:"not_subscribed"`
+	// Default is the status of users not listed: subscribed, not_subscribed or
+	// not_found (the default).
+	Default string  `yaml:"default"`
+	Faults  []Fault `yaml:"faults"`
+}
+
+type Toys struct {
+	Catalog []Toy   `yaml:"catalog"`
+	Faults  []Fault `yaml:"faults"`
+}
+
+type Toy struct {
+	ID             int64    `yaml:"id"`
+	Title          string   `yaml:"title"`
+	Desc           string   `yaml:"desc"`
+	Value          int64    `yaml:"value"`
+	Images         []string `yaml:"images"`
+	Skills         []string `yaml:"skills"`
+	Categories     []string `yaml:"categories"`
+	RecommendedAge string   `yaml:"recommended_age"`
+	Manufacturer   string   `yaml:"manufacturer"`
+	// Available defaults to true.
+	Available *bool `yaml:"available"`
+}
+
+// Fault delays or fails matching calls.
+type Fault struct {
+	// Method is the RPC name, e.g. "GetToy"; empty matches every method.
+	Method string `yaml:"method"`
+	// IDs limits the fault to these users (subscriptions) or toys (toys).
+	IDs []int64 `yaml:"ids"`
+	// Latency is added before the call is answered.
+	Latency time.Duration `yaml:"latency"`
+	// Code, when set, fails the call with this status, e.g. UNAVAILABLE.
+	Code    string `yaml:"code"`
+	Message string `yaml:"message"`
+	// Rate is the share of matching calls affected, in [0, 1]; 0 affects every call.
+	Rate float64 `yaml:"rate"`
+	// Times stops the fault after it fired that many times; 0 never stops it.
+	Times int `yaml:"times"`
+}
+
+// LoadFixture reads a YAML or JSON fixture; JSON is read as YAML, of which it is a
+// subset.
+func LoadFixture(path string) (*Fixture, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", "stubs.LoadFixture", err)
+	}
+
+	f := &Fixture{}
+	if err := yaml.Unmarshal(raw, f); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", "stubs.LoadFixture", path, err)
+	}
+	if _, err := compile(f); err != nil {
+		return nil, fmt.Errorf("%s: %s: %w", "stubs.LoadFixture", path, err)
+	}
+	return f, nil
+}
+
+// state is a fixture prepared for lookups; it is replaced as a whole when the fixture
+// changes so a call never sees half of one.
+type state struct {
+	users       map[int64]subs.Status
+	defaultSubs subs.Status
+	subsFaults  []*fault
+	catalog     map[int64]*toys.Toy
+	toysFaults  []*fault
+}
+
+type fault struct {
+	Fault
+	code  codes.Code
+	ids   map[int64]bool
+	fired int
+}
+
+func compile(f *Fixture) (*state, error) {
+	st := &state{
+		users:   make(map[int64]subs.Status),
+		catalog: make(map[int64]*toys.Toy, len(f.Toys.Catalog)),
+	}
+
+	switch strings.ToLower(f.Subscriptions.Default) {
+	case "", "not_found":
+		st.defaultSubs = subs.Status_STATUS_SUBSCRIPTION_NOTFOUND
+	case "subscribed":
+		st.defaultSubs = subs.Status_STATUS_SUBSCRIBED
+	case "not_subscribed":
+		st.defaultSubs = subs.Status_STATUS_NOT_SUBSCRIBED
+	default:
+		return nil, fmt.Errorf("unknown default subscription status %q", f.Subscriptions.Default)
+	}
+	for _, id := range f.Subscriptions.NotSubscribed {
+		st.users[id] = subs.Status_STATUS_NOT_SUBSCRIBED
+	}
+	for _, id := range f.Subscriptions.Subscribed {
+		st.users[id] = subs.Status_STATUS_SUBSCRIBED
+	}
+
+	for _, t := range f.Toys.Catalog {
+		if _, ok := st.catalog[t.ID]; ok {
+			return nil, fmt.Errorf("toy %d is listed twice", t.ID)
+		}
+		available := t.Available == nil || *t.Available
+		st.catalog[t.ID] = &toys.Toy{
+			Id:             t.ID,
+			Title:          t.Title,
+			Desc:           t.Desc,
+			Value:          t.Value,
+			Images:         t.Images,
+			Skills:         t.Skills,
+			Categories:     t.Categories,
+			RecommendedAge: t.RecommendedAge,
+			Manufacturer:   t.Manufacturer,
+			IsAvailable:    available,
+		}
+	}
+
+	var err error
+	if st.subsFaults, err = compileFaults(f.Subscriptions.Faults); err != nil {
+		return nil, fmt.Errorf("subscriptions: %w", err)
+	}
+	if st.toysFaults, err = compileFaults(f.Toys.Faults); err != nil {
+		return nil, fmt.Errorf("toys: %w", err)
+	}
+	return st, nil
+}
+
+func compileFaults(faults []Fault) ([]*fault, error) {
+	compiled := make([]*fault, 0, len(faults))
+	for i, f := range faults {
+		if f.Rate < 0 || f.Rate > 1 {
+			return nil, fmt.Errorf("fault %d: rate %v is not in [0, 1]", i, f.Rate)
+		}
+		c := &fault{Fault: f}
+		if f.Code != "" {
+			if err := c.code.UnmarshalJSON([]byte(`"` + strings.ToUpper(f.Code) + `"`)); err != nil {
+				return nil, fmt.Errorf("fault %d: unknown status code %q", i, f.Code)
+			}
+			if c.code == codes.OK {
+				return nil, fmt.Errorf("fault %d: code OK is not a fault", i)
+			}
+		}
+		if len(f.IDs) > 0 {
+			c.ids = make(map[int64]bool, len(f.IDs))
+			for _, id := range f.IDs {
+				c.ids[id] = true
+			}
+		}
+		compiled = append(compiled, c)
+	}
+	return compiled, nil
+}
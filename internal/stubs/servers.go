@@ -0,0 +1,119 @@
+package stubs
+
+import (
+	"context"
+	"encoding/json"
+	"strconv"
+	"strings"
+
+	"github.com/golang-jwt/jwt/v5"
+	subs "github.com/spacecowboytobykty123/subsProto/gen/go/subscription"
+	"github.com/spacecowboytobykty123/toysProto/gen/go/toys"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+type subscriptionServer struct {
+	subs.UnimplementedSubscriptionServer
+	stubs *Stubs
+}
+
+// CheckSubscription answers for the user of the caller's token, like the real service.
+func (s *subscriptionServer) CheckSubscription(ctx context.Context, req *subs.CheckSubsRequest) (*subs.CheckSubsResponse, error) {
+	userID, err := callerID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	st, err := s.stubs.enter(ctx, "subscriptions", "CheckSubscription", userID)
+	if err != nil {
+		return nil, err
+	}
+
+	subStatus, ok := st.users[userID]
+	if !ok {
+		subStatus = st.defaultSubs
+	}
+	return &subs.CheckSubsResponse{SubStatus: subStatus}, nil
+}
+
+type toysServer struct {
+	toys.UnimplementedToysServer
+	stubs *Stubs
+}
+
+func (s *toysServer) GetToy(ctx context.Context, req *toys.GetToyRequest) (*toys.GetToyResponse, error) {
+	st, err := s.stubs.enter(ctx, "toys", "GetToy", req.GetToyId())
+	if err != nil {
+		return nil, err
+	}
+
+	toy, ok := st.catalog[req.GetToyId()]
+	if !ok {
+		return nil, status.Errorf(codes.NotFound, "toy %d not found", req.GetToyId())
+	}
+	return &toys.GetToyResponse{
+		Toy:    proto.Clone(toy).(*toys.Toy),
+		Status: toys.Status_STATUS_OK,
+	}, nil
+}
+
+func (s *toysServer) GetToysByIds(ctx context.Context, req *toys.GetToysByIdsRequest) (*toys.GetToysByIdsResponse, error) {
+	st, err := s.stubs.enter(ctx, "toys", "GetToysByIds", 0)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &toys.GetToysByIdsResponse{}
+	for _, id := range req.GetId() {
+		if toy, ok := st.catalog[id]; ok {
+			resp.Toy = append(resp.Toy, &toys.ToySummary{
+				Id:    toy.Id,
+				Title: toy.Title,
+				Value: toy.Value,
+			})
+		}
+	}
+	return resp, nil
+}
+
+// callerID reads the user id from the bearer token without verifying it, or from an
+// x-user-id header for calls made by hand.
+func callerID(ctx context.Context) (int64, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+
+	if values := md.Get("authorization"); len(values) > 0 {
+		token, ok := strings.CutPrefix(values[0], "Bearer ")
+		if !ok {
+			return 0, status.Error(codes.Unauthenticated, "authorization is not a bearer token")
+		}
+		claims := jwt.MapClaims{}
+		if _, _, err := jwt.NewParser(jwt.WithJSONNumber()).ParseUnverified(token, claims); err != nil {
+			return 0, status.Errorf(codes.Unauthenticated, "malformed token: %v", err)
+		}
+		raw, ok := claims["user_id"]
+		if !ok {
+			raw = claims["sub"]
+		}
+		var id string
+		switch v := raw.(type) {
+		case json.Number:
+			id = v.String()
+		case string:
+			id = v
+		}
+		if userID, err := strconv.ParseInt(id, 10, 64); err == nil {
+			return userID, nil
+		}
+		return 0, status.Error(codes.Unauthenticated, "token has no numeric user_id or sub")
+	}
+
+	if values := md.Get("x-user-id"); len(values) > 0 {
+		if userID, err := strconv.ParseInt(values[0], 10, 64); err == nil {
+			return userID, nil
+		}
+	}
+	return 0, status.Error(codes.Unauthenticated, "no user in request")
+}
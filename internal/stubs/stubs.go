@@ -0,0 +1,179 @@
+// Package stubs implements the subscriptions and toys services from a fixture, for
+// running the cart service locally and in tests.
+package stubs
+
+import (
+	"cartService/internal/clients/conn"
+	"cartService/internal/jsonlog"
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"net"
+	"strconv"
+	"sync"
+	"time"
+
+	subs "github.com/spacecowboytobykty123/subsProto/gen/go/subscription"
+	"github.com/spacecowboytobykty123/toysProto/gen/go/toys"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Stubs holds the scripted behaviour shared by both stub services. The fixture can be
+// replaced while they serve.
+type Stubs struct {
+	log *jsonlog.Logger
+
+	mu    sync.Mutex
+	state *state
+	calls map[string]int
+}
+
+func New(log *jsonlog.Logger, f *Fixture) (*Stubs, error) {
+	s := &Stubs{
+		log:   log,
+		calls: make(map[string]int),
+	}
+	if err := s.SetFixture(f); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// SetFixture replaces the fixture; fault counters start over.
+func (s *Stubs) SetFixture(f *Fixture) error {
+	if f == nil {
+		f = &Fixture{}
+	}
+	st, err := compile(f)
+	if err != nil {
+		return fmt.Errorf("%s: %w", "stubs.SetFixture", err)
+	}
+
+	s.mu.Lock()
+	s.state = st
+	s.mu.Unlock()
+	return nil
+}
+
+// Calls reports how many times method ("CheckSubscription", "GetToy", ...) was called.
+func (s *Stubs) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
+
+// RegisterSubscriptions adds the subscriptions stub to srv.
+func (s *Stubs) RegisterSubscriptions(srv grpc.ServiceRegistrar) {
+	subs.RegisterSubscriptionServer(srv, &subscriptionServer{stubs: s})
+}
+
+// RegisterToys adds the toys stub to srv.
+func (s *Stubs) RegisterToys(srv grpc.ServiceRegistrar) {
+	toys.RegisterToysServer(srv, &toysServer{stubs: s})
+}
+
+// enter counts a call and applies the faults matching it, returning the state to
+// answer from or the injected error.
+func (s *Stubs) enter(ctx context.Context, service, method string, id int64) (*state, error) {
+	s.mu.Lock()
+	s.calls[method]++
+	st := s.state
+	faults := st.subsFaults
+	if service == "toys" {
+		faults = st.toysFaults
+	}
+
+	var latency time.Duration
+	var injected *fault
+	for _, f := range faults {
+		if (f.Method != "" && f.Method != method) || (f.ids != nil && !f.ids[id]) {
+			continue
+		}
+		if f.Times > 0 && f.fired >= f.Times {
+			continue
+		}
+		if f.Rate > 0 && rand.Float64() >= f.Rate {
+			continue
+		}
+		f.fired++
+		latency += f.Latency
+		if injected == nil && f.code != 0 {
+			injected = f
+		}
+	}
+	s.mu.Unlock()
+
+	if latency > 0 {
+		timer := time.NewTimer(latency)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, status.FromContextError(ctx.Err()).Err()
+		case <-timer.C:
+		}
+	}
+
+	if injected != nil {
+		s.log.PrintInfo("injecting fault", map[string]string{
+			"method":  "stubs.enter",
+			"service": service,
+			"rpc":     method,
+			"id":      strconv.FormatInt(id, 10),
+			"code":    injected.code.String(),
+		})
+		msg := injected.Message
+		if msg == "" {
+			msg = "injected by stub fixture"
+		}
+		return nil, status.Error(injected.code, msg)
+	}
+	return st, nil
+}
+
+// Bufconn serves both stub services in process over an in-memory listener.
+type Bufconn struct {
+	*Stubs
+	server   *grpc.Server
+	listener *bufconn.Listener
+}
+
+// NewBufconn starts the stubs on an in-memory listener; Close stops them.
+func NewBufconn(log *jsonlog.Logger, f *Fixture) (*Bufconn, error) {
+	stubs, err := New(log, f)
+	if err != nil {
+		return nil, err
+	}
+
+	b := &Bufconn{
+		Stubs:    stubs,
+		server:   grpc.NewServer(),
+		listener: bufconn.Listen(1 << 20),
+	}
+	stubs.RegisterSubscriptions(b.server)
+	stubs.RegisterToys(b.server)
+	healthpb.RegisterHealthServer(b.server, health.NewServer())
+
+	go b.server.Serve(b.listener)
+	return b, nil
+}
+
+// ConnConfig returns a client config that reaches the stubs through the listener.
+func (b *Bufconn) ConnConfig() conn.Config {
+	return conn.Config{
+		Target:        "passthrough:///bufconn",
+		LoadBalancing: "pick_first",
+		Dialer:        b.Dial,
+	}
+}
+
+func (b *Bufconn) Dial(ctx context.Context, _ string) (net.Conn, error) {
+	return b.listener.DialContext(ctx)
+}
+
+func (b *Bufconn) Close() {
+	b.server.Stop()
+}
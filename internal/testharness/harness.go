@@ -0,0 +1,239 @@
+// Package testharness runs the cart service in process for end-to-end tests: the real
+// gRPC server with its interceptors, the cart and admin services, memory or
+// PostgreSQL storage, and stub subscriptions and toys services, all over bufconn.
+package testharness
+
+import (
+	"bytes"
+	"cartService/internal/app/grpcapp"
+	"cartService/internal/audit"
+	"cartService/internal/auth"
+	"cartService/internal/clients/credentials"
+	"cartService/internal/clients/retry"
+	subsgrpc "cartService/internal/clients/subscriptions/grpc"
+	toysgrpc "cartService/internal/clients/toys/grpc"
+	"cartService/internal/data"
+	admingrpc "cartService/internal/grpc/admin"
+	crtgrpc "cartService/internal/grpc/cart"
+	"cartService/internal/jsonlog"
+	"cartService/internal/ratelimit"
+	"cartService/internal/services/admin"
+	"cartService/internal/services/cart"
+	"cartService/internal/stubs"
+	"cartService/storage/memory"
+	"cartService/storage/postgres"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// Secret signs the tokens minted by the harness (HS256).
+const Secret = "testharness-secret"
+
+type Options struct {
+	// Fixture scripts the stub services; nil subscribes every user and has no toys.
+	Fixture *stubs.Fixture
+	// DSN, when set, stores carts in that PostgreSQL database, migrated on start,
+	// instead of in memory.
+	DSN string
+	// Storage, when set, stores carts instead and takes precedence over DSN, e.g. to
+	// inject a failing storage.
+	Storage Storage
+	// SubsPolicy defaults to cart.DefaultSubsPolicy.
+	SubsPolicy *cart.SubsPolicy
+	// Limiter enables rate limiting.
+	Limiter *ratelimit.Limiter
+	// Retry configures both downstream clients; the zero value makes one attempt.
+	Retry retry.Config
+	// Log receives the service logs; nil discards them.
+	Log io.Writer
+}
+
+// Storage is what the harness exposes of the cart storage, to seed and inspect carts
+// without going through the API.
+type Storage interface {
+	AddToCart(ctx context.Context, toy data.CartItem, userID int64) (cart_v1_crt.OperationStatus, string)
+	DelFromCart(ctx context.Context, toyId int64, userID int64) (cart_v1_crt.OperationStatus, string)
+	ClearCart(ctx context.Context, userID int64) (cart_v1_crt.OperationStatus, string)
+	GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32)
+	Watch(ctx context.Context, userID int64) (<-chan struct{}, func())
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+type Harness struct {
+	App     *grpcapp.App
+	Stubs   *stubs.Bufconn
+	Storage Storage
+	// Conn reaches App; Cart, Watch and Admin are clients on it.
+	Conn  *grpc.ClientConn
+	Cart  cart_v1_crt.CartClient
+	Watch *crtgrpc.WatchClient
+	Admin *admingrpc.Client
+	// Audit collects the admin audit log.
+	Audit *bytes.Buffer
+
+	listener *bufconn.Listener
+}
+
+// Start boots the service and stops it when tb finishes; it fails tb on any error.
+func Start(tb testing.TB, opts Options) *Harness {
+	tb.Helper()
+
+	h, err := start(opts)
+	if err != nil {
+		tb.Fatalf("testharness.Start: %v", err)
+	}
+	tb.Cleanup(h.Close)
+	return h
+}
+
+func start(opts Options) (h *Harness, err error) {
+	out := opts.Log
+	if out == nil {
+		out = io.Discard
+	}
+	log := jsonlog.New(out, jsonlog.LevelInfo)
+
+	fixture := opts.Fixture
+	if fixture == nil {
+		fixture = &stubs.Fixture{Subscriptions: stubs.Subscriptions{Default: "subscribed"}}
+	}
+
+	h = &Harness{
+		Audit:    &bytes.Buffer{},
+		listener: bufconn.Listen(1 << 20),
+	}
+	defer func() {
+		if err != nil {
+			h.Close()
+		}
+	}()
+
+	if h.Stubs, err = stubs.NewBufconn(log, fixture); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case opts.Storage != nil:
+		h.Storage = opts.Storage
+	case opts.DSN != "":
+		if h.Storage, err = postgres.OpenDB(log, postgres.StorageDetails{
+			DSN:          opts.DSN,
+			MaxOpenConns: 5,
+			MaxIdleConns: 5,
+			MaxIdleTime:  "1m",
+			AutoMigrate:  true,
+		}); err != nil {
+			return nil, err
+		}
+	default:
+		h.Storage = memory.New()
+	}
+
+	ctx := context.Background()
+	creds := credentials.Forwarded{}
+	subsClient, err := subsgrpc.New(ctx, log, h.Stubs.ConnConfig(), opts.Retry, subsgrpc.CacheConfig{}, creds, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+	toyClient, err := toysgrpc.New(ctx, log, h.Stubs.ConnConfig(), opts.Retry, toysgrpc.CacheConfig{}, creds, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	subsPolicy := cart.DefaultSubsPolicy()
+	if opts.SubsPolicy != nil {
+		subsPolicy = *opts.SubsPolicy
+	}
+
+	verifier := auth.NewVerifier(auth.NewKeySet(auth.Key{Key: []byte(Secret)}), auth.Config{
+		Algorithms: []string{"HS256"},
+	})
+
+	h.App = grpcapp.New(log, 0,
+		cart.New(log, h.Storage, time.Hour, subsPolicy, subsClient, toyClient),
+		admin.New(log, h.Storage, toyClient, audit.New(h.Audit)),
+		verifier, opts.Limiter, nil)
+	go h.App.GRPCServer.Serve(h.listener)
+
+	h.Conn, err = grpc.NewClient("passthrough:///cart",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return h.listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", "testharness.start", err)
+	}
+	h.Cart = cart_v1_crt.NewCartClient(h.Conn)
+	h.Watch = crtgrpc.NewWatchClient(h.Conn)
+	h.Admin = admingrpc.NewClient(h.Conn)
+
+	return h, nil
+}
+
+// Close stops the service and the stubs and closes the storage.
+func (h *Harness) Close() {
+	if h.Conn != nil {
+		h.Conn.Close()
+	}
+	if h.App != nil {
+		h.App.GRPCServer.Stop()
+	}
+	if h.Stubs != nil {
+		h.Stubs.Close()
+	}
+	if h.Storage != nil {
+		h.Storage.Close()
+	}
+}
+
+// Token mints a token for userID, valid for an hour, with the given roles.
+func Token(userID int64, roles ...string) string {
+	claims := jwt.MapClaims{
+		"user_id": strconv.FormatInt(userID, 10),
+		"iat":     time.Now().Unix(),
+		"exp":     time.Now().Add(time.Hour).Unix(),
+	}
+	if len(roles) > 0 {
+		claims["roles"] = roles
+	}
+	return Mint(claims)
+}
+
+// Mint signs arbitrary claims, e.g. an expired "exp" or a missing user id.
+func Mint(claims jwt.MapClaims) string {
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(Secret))
+	if err != nil {
+		// Signing with an HMAC key only fails on a non-[]byte key.
+		panic(err)
+	}
+	return token
+}
+
+// WithToken returns ctx carrying token as the bearer of outgoing calls.
+func WithToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, "authorization", "Bearer "+token)
+}
+
+// AsUser returns ctx authenticated as userID with the given roles.
+func AsUser(ctx context.Context, userID int64, roles ...string) context.Context {
+	return WithToken(ctx, Token(userID, roles...))
+}
+
+// AsAdmin returns ctx authenticated as userID with the admin role.
+func AsAdmin(ctx context.Context, userID int64) context.Context {
+	return AsUser(ctx, userID, admingrpc.AdminRole)
+}
@@ -0,0 +1,486 @@
+package testharness_test
+
+import (
+	"cartService/internal/app/grpcapp"
+	"cartService/internal/audit"
+	"cartService/internal/data"
+	"cartService/internal/ratelimit"
+	"cartService/internal/services/cart"
+	"cartService/internal/stubs"
+	"cartService/internal/testharness"
+	"cartService/storage/memory"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	subscribedUser   = 1
+	unsubscribedUser = 2
+	unavailableUser  = 3
+)
+
+func fixture() *stubs.Fixture {
+	return &stubs.Fixture{
+		Subscriptions: stubs.Subscriptions{
+			Subscribed:    []int64{subscribedUser, unavailableUser},
+			NotSubscribed: []int64{unsubscribedUser},
+			Default:       "subscribed",
+			Faults: []stubs.Fault{
+				{Method: "CheckSubscription", IDs: []int64{unavailableUser}, Code: "UNAVAILABLE"},
+			},
+		},
+		Toys: stubs.Toys{
+			Catalog: []stubs.Toy{
+				{ID: 10, Title: "Robot"},
+				{ID: 20, Title: "Kite"},
+			},
+		},
+	}
+}
+
+// start runs the service on memory storage, or on PostgreSQL when CART_TEST_DSN is set.
+func start(t *testing.T) *testharness.Harness {
+	t.Helper()
+	closed := cart.SubsPolicy{}
+	return testharness.Start(t, testharness.Options{
+		Fixture:    fixture(),
+		DSN:        os.Getenv("CART_TEST_DSN"),
+		SubsPolicy: &closed,
+	})
+}
+
+func add(toyID int64, qty int32) *cart_v1_crt.AddToCartRequest {
+	return &cart_v1_crt.AddToCartRequest{Toy: &cart_v1_crt.CartItem{ToyId: toyID, Quantity: qty}}
+}
+
+func dataItem(toyID int64, qty int32) data.CartItem {
+	return data.CartItem{ToyID: toyID, Quantity: qty}
+}
+
+func TestCartRoundTrip(t *testing.T) {
+	h := start(t)
+	ctx := testharness.AsUser(context.Background(), subscribedUser)
+	h.Storage.ClearCart(ctx, subscribedUser)
+
+	for _, req := range []*cart_v1_crt.AddToCartRequest{add(10, 2), add(20, 1), add(10, 1)} {
+		resp, err := h.Cart.AddToCart(ctx, req)
+		if err != nil {
+			t.Fatalf("AddToCart(%v): %v", req, err)
+		}
+		if resp.OpStatus != cart_v1_crt.OperationStatus_STATUS_OK {
+			t.Fatalf("AddToCart(%v) = %v %q, want STATUS_OK", req, resp.OpStatus, resp.Message)
+		}
+	}
+
+	got, err := h.Cart.GetCart(ctx, &cart_v1_crt.GetCartRequest{})
+	if err != nil {
+		t.Fatalf("GetCart: %v", err)
+	}
+	if got.TotalItems != 2 || got.TotalQuantity != 4 {
+		t.Fatalf("GetCart totals = %d items, %d toys, want 2 and 4", got.TotalItems, got.TotalQuantity)
+	}
+
+	del, err := h.Cart.DelFromCart(ctx, &cart_v1_crt.DelFromCartRequest{ToyId: 20})
+	if err != nil || del.OpStatus != cart_v1_crt.OperationStatus_STATUS_OK {
+		t.Fatalf("DelFromCart(20) = %v, %v, want STATUS_OK", del, err)
+	}
+	del, err = h.Cart.DelFromCart(ctx, &cart_v1_crt.DelFromCartRequest{ToyId: 20})
+	if err != nil || del.OpStatus != cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR {
+		t.Fatalf("DelFromCart(20) again = %v, %v, want STATUS_INTERNAL_ERROR", del, err)
+	}
+
+	got, err = h.Cart.GetCart(ctx, &cart_v1_crt.GetCartRequest{})
+	if err != nil {
+		t.Fatalf("GetCart: %v", err)
+	}
+	if got.TotalItems != 1 || got.TotalQuantity != 3 || got.Items[0].ToyId != 10 {
+		t.Fatalf("GetCart = %v, want 3 of toy 10", got)
+	}
+}
+
+func TestCartOperationStatus(t *testing.T) {
+	h := start(t)
+
+	tests := []struct {
+		name    string
+		user    int64
+		req     *cart_v1_crt.AddToCartRequest
+		want    cart_v1_crt.OperationStatus
+		message string
+	}{
+		{"not subscribed", unsubscribedUser, add(10, 1), cart_v1_crt.OperationStatus_STATUS_INVALID_USER, "not subscribed"},
+		{"unknown toy", subscribedUser, add(99, 1), cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "not exist"},
+		{"subscriptions unavailable", unavailableUser, add(10, 1), cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "unavailable"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp, err := h.Cart.AddToCart(testharness.AsUser(context.Background(), tt.user), tt.req)
+			if err != nil {
+				t.Fatalf("AddToCart: %v", err)
+			}
+			if resp.OpStatus != tt.want || !strings.Contains(resp.Message, tt.message) {
+				t.Fatalf("AddToCart = %v %q, want %v containing %q", resp.OpStatus, resp.Message, tt.want, tt.message)
+			}
+		})
+	}
+
+	t.Run("unsubscribed GetCart is empty", func(t *testing.T) {
+		h.Storage.AddToCart(context.Background(), dataItem(10, 1), unsubscribedUser)
+		got, err := h.Cart.GetCart(testharness.AsUser(context.Background(), unsubscribedUser), &cart_v1_crt.GetCartRequest{})
+		if err != nil {
+			t.Fatalf("GetCart: %v", err)
+		}
+		if len(got.Items) != 0 {
+			t.Fatalf("GetCart = %v, want no items", got.Items)
+		}
+	})
+}
+
+func TestInvalidArgument(t *testing.T) {
+	h := start(t)
+	ctx := testharness.AsUser(context.Background(), subscribedUser)
+
+	_, err := h.Cart.AddToCart(ctx, add(10, 0))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("AddToCart without quantity: %v, want InvalidArgument", err)
+	}
+	_, err = h.Cart.AddToCart(ctx, add(0, 1))
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("AddToCart without toy id: %v, want InvalidArgument", err)
+	}
+	_, err = h.Cart.DelFromCart(ctx, &cart_v1_crt.DelFromCartRequest{})
+	if status.Code(err) != codes.InvalidArgument {
+		t.Errorf("DelFromCart without toy id: %v, want InvalidArgument", err)
+	}
+}
+
+// failingStore is a rate limit store that is always down, e.g. an unreachable Redis.
+type failingStore struct{}
+
+func (failingStore) Take(ctx context.Context, key string, limit ratelimit.Limit) (bool, time.Duration, error) {
+	return false, 0, errors.New("store down")
+}
+
+func TestRateLimit(t *testing.T) {
+	limits := map[string]ratelimit.Limit{cart_v1_crt.Cart_GetCart_FullMethodName: {Rate: 0.001, Burst: 1}}
+
+	t.Run("exhausted", func(t *testing.T) {
+		h := testharness.Start(t, testharness.Options{
+			Fixture: fixture(),
+			Limiter: ratelimit.New(ratelimit.NewLocalStore(), limits, false),
+		})
+		ctx := testharness.AsUser(context.Background(), subscribedUser)
+
+		if _, err := h.Cart.GetCart(ctx, &cart_v1_crt.GetCartRequest{}); err != nil {
+			t.Fatalf("first GetCart: %v", err)
+		}
+		var header metadata.MD
+		_, err := h.Cart.GetCart(ctx, &cart_v1_crt.GetCartRequest{}, grpc.Header(&header))
+		if status.Code(err) != codes.ResourceExhausted {
+			t.Fatalf("second GetCart: %v, want ResourceExhausted", err)
+		}
+		if got := header.Get(grpcapp.RetryAfterHeader); len(got) != 1 || got[0] == "0" {
+			t.Fatalf("retry-after = %q, want a positive number of seconds", got)
+		}
+
+		other := testharness.AsUser(context.Background(), unsubscribedUser)
+		if _, err := h.Cart.GetCart(other, &cart_v1_crt.GetCartRequest{}); status.Code(err) == codes.ResourceExhausted {
+			t.Fatal("limit of one user applied to another")
+		}
+	})
+
+	t.Run("store down, failing closed", func(t *testing.T) {
+		h := testharness.Start(t, testharness.Options{
+			Fixture: fixture(),
+			Limiter: ratelimit.New(failingStore{}, limits, false),
+		})
+		ctx := testharness.AsUser(context.Background(), subscribedUser)
+
+		var header metadata.MD
+		_, err := h.Cart.GetCart(ctx, &cart_v1_crt.GetCartRequest{}, grpc.Header(&header))
+		if status.Code(err) != codes.Unavailable {
+			t.Fatalf("GetCart: %v, want Unavailable", err)
+		}
+		if got := header.Get(grpcapp.RetryAfterHeader); len(got) != 0 {
+			t.Fatalf("retry-after = %q, want none", got)
+		}
+	})
+
+	t.Run("store down, failing open", func(t *testing.T) {
+		h := testharness.Start(t, testharness.Options{
+			Fixture: fixture(),
+			Limiter: ratelimit.New(failingStore{}, limits, true),
+		})
+		ctx := testharness.AsUser(context.Background(), subscribedUser)
+
+		if _, err := h.Cart.GetCart(ctx, &cart_v1_crt.GetCartRequest{}); err != nil {
+			t.Fatalf("GetCart: %v, want it let through", err)
+		}
+	})
+}
+
+func TestAuthentication(t *testing.T) {
+	h := start(t)
+
+	now := time.Now()
+	wrongAlg, err := jwt.NewWithClaims(jwt.SigningMethodHS384, jwt.MapClaims{
+		"user_id": "1",
+		"iat":     now.Unix(),
+		"exp":     now.Add(time.Hour).Unix(),
+	}).SignedString([]byte(testharness.Secret))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+	}{
+		{"missing token", context.Background()},
+		{"malformed token", testharness.WithToken(context.Background(), "not-a-jwt")},
+		{"expired token", testharness.WithToken(context.Background(), testharness.Mint(jwt.MapClaims{
+			"user_id": "1",
+			"iat":     now.Add(-2 * time.Hour).Unix(),
+			"exp":     now.Add(-time.Hour).Unix(),
+		}))},
+		{"wrong algorithm", testharness.WithToken(context.Background(), wrongAlg)},
+		{"missing user id", testharness.WithToken(context.Background(), testharness.Mint(jwt.MapClaims{
+			"iat": now.Unix(),
+			"exp": now.Add(time.Hour).Unix(),
+		}))},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := h.Cart.GetCart(tt.ctx, &cart_v1_crt.GetCartRequest{}); status.Code(err) != codes.Unauthenticated {
+				t.Errorf("GetCart: %v, want Unauthenticated", err)
+			}
+			if _, err := h.Cart.AddToCart(tt.ctx, add(10, 1)); status.Code(err) != codes.Unauthenticated {
+				t.Errorf("AddToCart: %v, want Unauthenticated", err)
+			}
+			if _, err := h.Admin.GetUserCart(tt.ctx, subscribedUser); status.Code(err) != codes.Unauthenticated {
+				t.Errorf("GetUserCart: %v, want Unauthenticated", err)
+			}
+
+			updates, err := h.Watch.WatchCart(tt.ctx)
+			if err == nil {
+				_, err = updates.Recv()
+			}
+			if status.Code(err) != codes.Unauthenticated {
+				t.Errorf("WatchCart: %v, want Unauthenticated", err)
+			}
+		})
+	}
+}
+
+// failingReads is a cart storage whose reads fail, reported as a nil cart.
+type failingReads struct {
+	*memory.Storage
+}
+
+func (failingReads) GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32) {
+	return nil, 0, 0
+}
+
+func TestWatchCart(t *testing.T) {
+	h := start(t)
+	ctx, cancel := context.WithTimeout(testharness.AsUser(context.Background(), subscribedUser), 10*time.Second)
+	defer cancel()
+	h.Storage.ClearCart(ctx, subscribedUser)
+
+	updates, err := h.Watch.WatchCart(ctx)
+	if err != nil {
+		t.Fatalf("WatchCart: %v", err)
+	}
+	first, err := updates.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if len(first.Items) != 0 {
+		t.Fatalf("first update = %v, want an empty cart", first)
+	}
+
+	if resp, err := h.Cart.AddToCart(ctx, add(20, 2)); err != nil || resp.OpStatus != cart_v1_crt.OperationStatus_STATUS_OK {
+		t.Fatalf("AddToCart = %v, %v", resp, err)
+	}
+	next, err := updates.Recv()
+	if err != nil {
+		t.Fatalf("Recv: %v", err)
+	}
+	if next.TotalQuantity != 2 || len(next.Items) != 1 || next.Items[0].ToyId != 20 {
+		t.Fatalf("update after AddToCart = %v, want 2 of toy 20", next)
+	}
+
+	t.Run("not subscribed", func(t *testing.T) {
+		updates, err := h.Watch.WatchCart(testharness.AsUser(context.Background(), unsubscribedUser))
+		if err == nil {
+			_, err = updates.Recv()
+		}
+		if status.Code(err) != codes.PermissionDenied {
+			t.Fatalf("WatchCart: %v, want PermissionDenied", err)
+		}
+	})
+
+	t.Run("ends when the token expires", func(t *testing.T) {
+		now := time.Now()
+		ctx := testharness.WithToken(context.Background(), testharness.Mint(jwt.MapClaims{
+			"user_id": "1",
+			"iat":     now.Unix(),
+			"exp":     now.Add(2 * time.Second).Unix(),
+		}))
+		updates, err := h.Watch.WatchCart(ctx)
+		if err != nil {
+			t.Fatalf("WatchCart: %v", err)
+		}
+		if _, err := updates.Recv(); err != nil {
+			t.Fatalf("Recv: %v", err)
+		}
+		if _, err := updates.Recv(); status.Code(err) != codes.Unauthenticated {
+			t.Fatalf("Recv after expiry: %v, want Unauthenticated", err)
+		}
+	})
+
+	t.Run("cart can't be read", func(t *testing.T) {
+		h := testharness.Start(t, testharness.Options{
+			Fixture: fixture(),
+			Storage: failingReads{memory.New()},
+		})
+		updates, err := h.Watch.WatchCart(testharness.AsUser(context.Background(), subscribedUser))
+		if err == nil {
+			_, err = updates.Recv()
+		}
+		if status.Code(err) != codes.Unavailable {
+			t.Fatalf("WatchCart: %v, want Unavailable", err)
+		}
+	})
+}
+
+func TestAdmin(t *testing.T) {
+	h := start(t)
+	const target = 42
+	admin := testharness.AsAdmin(context.Background(), 7)
+	h.Storage.ClearCart(admin, target)
+
+	t.Run("requires admin role", func(t *testing.T) {
+		ctx := testharness.AsUser(context.Background(), subscribedUser)
+		if _, err := h.Admin.GetUserCart(ctx, target); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("GetUserCart: %v, want PermissionDenied", err)
+		}
+		if _, err := h.Admin.AddToUserCart(ctx, target, add(10, 1)); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("AddToUserCart: %v, want PermissionDenied", err)
+		}
+		if _, err := h.Admin.DelFromUserCart(ctx, target, &cart_v1_crt.DelFromCartRequest{ToyId: 10}); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("DelFromUserCart: %v, want PermissionDenied", err)
+		}
+		if _, err := h.Admin.ClearUserCart(ctx, target); status.Code(err) != codes.PermissionDenied {
+			t.Errorf("ClearUserCart: %v, want PermissionDenied", err)
+		}
+	})
+
+	resp, err := h.Admin.AddToUserCart(admin, target, add(10, 3))
+	if err != nil || resp.OpStatus != cart_v1_crt.OperationStatus_STATUS_OK {
+		t.Fatalf("AddToUserCart = %v, %v", resp, err)
+	}
+	resp, err = h.Admin.AddToUserCart(admin, target, add(99, 1))
+	if err != nil || resp.OpStatus != cart_v1_crt.OperationStatus_STATUS_INVALID_TOY {
+		t.Fatalf("AddToUserCart(unknown toy) = %v, %v, want STATUS_INVALID_TOY", resp, err)
+	}
+	if _, err := h.Admin.AddToUserCart(admin, target, add(10, 0)); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("AddToUserCart without quantity: %v, want InvalidArgument", err)
+	}
+
+	got, err := h.Admin.GetUserCart(admin, target)
+	if err != nil {
+		t.Fatalf("GetUserCart: %v", err)
+	}
+	if got.TotalQuantity != 3 {
+		t.Fatalf("GetUserCart = %v, want 3 toys", got)
+	}
+
+	del, err := h.Admin.DelFromUserCart(admin, target, &cart_v1_crt.DelFromCartRequest{ToyId: 10})
+	if err != nil || del.OpStatus != cart_v1_crt.OperationStatus_STATUS_OK {
+		t.Fatalf("DelFromUserCart = %v, %v", del, err)
+	}
+	h.Admin.AddToUserCart(admin, target, add(20, 1))
+	clear, err := h.Admin.ClearUserCart(admin, target)
+	if err != nil || clear.OpStatus != cart_v1_crt.OperationStatus_STATUS_OK {
+		t.Fatalf("ClearUserCart = %v, %v", clear, err)
+	}
+	clear, err = h.Admin.ClearUserCart(admin, target)
+	if err != nil || clear.OpStatus != cart_v1_crt.OperationStatus_STATUS_CART_EMPTY {
+		t.Fatalf("ClearUserCart on an empty cart = %v, %v, want STATUS_CART_EMPTY", clear, err)
+	}
+
+	var actions, denied []string
+	for _, line := range strings.Split(strings.TrimSpace(h.Audit.String()), "\n") {
+		var entry struct {
+			Type       string `json:"type"`
+			Actor      int64  `json:"actor"`
+			Action     string `json:"action"`
+			TargetUser int64  `json:"target_user"`
+			Status     string `json:"status"`
+		}
+		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatalf("audit line %q: %v", line, err)
+		}
+		if entry.Type != "audit" {
+			t.Errorf("audit entry %+v: type %q, want audit", entry, entry.Type)
+		}
+		if entry.TargetUser != target {
+			t.Errorf("audit entry %+v: target %d, want %d", entry, entry.TargetUser, target)
+		}
+		switch entry.Actor {
+		case 7:
+			actions = append(actions, entry.Action+":"+entry.Status)
+		case subscribedUser:
+			denied = append(denied, entry.Action+":"+entry.Status)
+		}
+	}
+	wantDenied := []string{
+		"get_cart:PERMISSION_DENIED",
+		"add_to_cart:PERMISSION_DENIED",
+		"del_from_cart:PERMISSION_DENIED",
+		"clear_cart:PERMISSION_DENIED",
+	}
+	if strings.Join(denied, " ") != strings.Join(wantDenied, " ") {
+		t.Errorf("audited denied attempts = %v, want %v", denied, wantDenied)
+	}
+	want := []string{
+		"add_to_cart:STATUS_OK",
+		"add_to_cart:STATUS_INVALID_TOY",
+		"add_to_cart:INVALID_ARGUMENT",
+		"get_cart:STATUS_OK",
+		"del_from_cart:STATUS_OK",
+		"add_to_cart:STATUS_OK",
+		"clear_cart:STATUS_OK",
+		"clear_cart:STATUS_CART_EMPTY",
+	}
+	if strings.Join(actions, " ") != strings.Join(want, " ") {
+		t.Fatalf("audited actions = %v, want %v", actions, want)
+	}
+
+	t.Run("invalid target", func(t *testing.T) {
+		h.Audit.Reset()
+		if _, err := h.Admin.ClearUserCart(admin, 0); status.Code(err) != codes.InvalidArgument {
+			t.Fatalf("ClearUserCart: %v, want InvalidArgument", err)
+		}
+		var entry audit.Entry
+		if err := json.Unmarshal(h.Audit.Bytes(), &entry); err != nil {
+			t.Fatalf("audit log %q: %v", h.Audit.String(), err)
+		}
+		if entry.Actor != 7 || entry.Action != "clear_cart" || entry.TargetUser != 0 || entry.Status != "INVALID_ARGUMENT" {
+			t.Fatalf("audited %+v, want a rejected clear_cart by 7", entry)
+		}
+	})
+}
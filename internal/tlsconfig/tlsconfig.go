@@ -0,0 +1,255 @@
+package tlsconfig
+
+import (
+	"cartService/internal/jsonlog"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+var ErrPeerNotAllowed = errors.New("tlsconfig: peer certificate identity not allowed")
+
+// Config describes one side of a TLS connection. CertFile and KeyFile are our own
+// certificate; CAFile holds the roots the peer's certificate must chain to. With an
+// empty CAFile servers don't ask for client certificates and clients use the system
+// roots.
+type Config struct {
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	CAFile   string `yaml:"ca_file"`
+	// ServerName overrides the name a client verifies the server certificate against.
+	ServerName string `yaml:"server_name"`
+	// AllowedSANs restricts which peers are accepted: at least one DNS, URI, IP or
+	// email SAN of the peer certificate must match. An entry ending in "*" matches by
+	// prefix, e.g. "spiffe://cluster.local/ns/shop/*".
+	AllowedSANs []string `yaml:"allowed_sans"`
+}
+
+// Enabled reports whether any TLS material is configured.
+func (c Config) Enabled() bool {
+	return c.CertFile != "" || c.CAFile != ""
+}
+
+// Reloader keeps the certificate and CA pool of a Config in memory and swaps them
+// when the files change, so rotated certificates are used by new connections without
+// a restart.
+type Reloader struct {
+	cfg Config
+
+	mu   sync.RWMutex
+	cert *tls.Certificate
+	pool *x509.CertPool
+}
+
+func NewReloader(cfg Config) (*Reloader, error) {
+	r := &Reloader{cfg: cfg}
+	if err := r.Load(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Load reads the certificate, key and CA files. Nothing is replaced if any of them
+// fails to load.
+func (r *Reloader) Load() error {
+	var cert *tls.Certificate
+	if r.cfg.CertFile != "" || r.cfg.KeyFile != "" {
+		c, err := tls.LoadX509KeyPair(r.cfg.CertFile, r.cfg.KeyFile)
+		if err != nil {
+			return fmt.Errorf("%s: %w", "tlsconfig.Load", err)
+		}
+		cert = &c
+	}
+
+	var pool *x509.CertPool
+	if r.cfg.CAFile != "" {
+		raw, err := os.ReadFile(r.cfg.CAFile)
+		if err != nil {
+			return fmt.Errorf("%s: %w", "tlsconfig.Load", err)
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return fmt.Errorf("tlsconfig.Load: %s: no certificates found", r.cfg.CAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert = cert
+	r.pool = pool
+	r.mu.Unlock()
+	return nil
+}
+
+func (r *Reloader) current() (*tls.Certificate, *x509.CertPool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, r.pool
+}
+
+// Watch polls the certificate, key and CA files every interval and reloads them when
+// one changes. It returns when ctx is done.
+func (r *Reloader) Watch(ctx context.Context, log *jsonlog.Logger, interval time.Duration) {
+	files := []string{r.cfg.CertFile, r.cfg.KeyFile, r.cfg.CAFile}
+	last := fileStamps(files)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		stamps := fileStamps(files)
+		if stamps == last {
+			continue
+		}
+
+		if err := r.Load(); err != nil {
+			// Files are often replaced one at a time; keep serving the old
+			// certificate until the set is consistent again.
+			log.PrintError(err, map[string]string{
+				"method": "tlsconfig.Watch",
+			})
+			continue
+		}
+		last = stamps
+		log.PrintInfo("reloaded TLS certificates", map[string]string{
+			"cert": r.cfg.CertFile,
+			"ca":   r.cfg.CAFile,
+		})
+	}
+}
+
+type fileStamp struct {
+	mod  time.Time
+	size int64
+}
+
+func fileStamps(files []string) [3]fileStamp {
+	var stamps [3]fileStamp
+	for i, f := range files {
+		if f == "" {
+			continue
+		}
+		if fi, err := os.Stat(f); err == nil {
+			stamps[i] = fileStamp{mod: fi.ModTime(), size: fi.Size()}
+		}
+	}
+	return stamps
+}
+
+// ServerConfig returns the TLS config of a server. When a CA is configured clients
+// must present a certificate signed by it (mutual TLS).
+func (r *Reloader) ServerConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetConfigForClient: func(*tls.ClientHelloInfo) (*tls.Config, error) {
+			cert, pool := r.current()
+			if cert == nil {
+				return nil, errors.New("tlsconfig: no server certificate configured")
+			}
+			cfg := &tls.Config{
+				MinVersion:   tls.VersionTLS12,
+				Certificates: []tls.Certificate{*cert},
+				NextProtos:   []string{"h2"},
+			}
+			if pool != nil {
+				cfg.ClientAuth = tls.RequireAndVerifyClientCert
+				cfg.ClientCAs = pool
+				cfg.VerifyConnection = r.verifyIdentity
+			}
+			return cfg, nil
+		},
+	}
+}
+
+// ClientConfig returns the TLS config of a client. The server certificate is verified
+// by hand against the current CA pool because crypto/tls offers no hook to swap
+// RootCAs on an existing config.
+func (r *Reloader) ClientConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: r.cfg.ServerName,
+		// Verification is done in VerifyConnection below.
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := r.current()
+			if cert == nil {
+				return &tls.Certificate{}, nil
+			}
+			return cert, nil
+		},
+		VerifyConnection: func(cs tls.ConnectionState) error {
+			if len(cs.PeerCertificates) == 0 {
+				return errors.New("tlsconfig: server presented no certificate")
+			}
+			_, pool := r.current()
+
+			opts := x509.VerifyOptions{
+				Roots:         pool,
+				DNSName:       cs.ServerName,
+				Intermediates: x509.NewCertPool(),
+			}
+			for _, c := range cs.PeerCertificates[1:] {
+				opts.Intermediates.AddCert(c)
+			}
+			if _, err := cs.PeerCertificates[0].Verify(opts); err != nil {
+				return fmt.Errorf("%s: %w", "tlsconfig.VerifyConnection", err)
+			}
+			return r.verifyIdentity(cs)
+		},
+	}
+}
+
+func (r *Reloader) verifyIdentity(cs tls.ConnectionState) error {
+	if len(r.cfg.AllowedSANs) == 0 {
+		return nil
+	}
+	if len(cs.PeerCertificates) == 0 {
+		return ErrPeerNotAllowed
+	}
+	for _, san := range SANs(cs.PeerCertificates[0]) {
+		if matchSAN(r.cfg.AllowedSANs, san) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %s", ErrPeerNotAllowed, strings.Join(SANs(cs.PeerCertificates[0]), ","))
+}
+
+// SANs lists the subject alternative names of cert.
+func SANs(cert *x509.Certificate) []string {
+	sans := make([]string, 0, len(cert.DNSNames)+len(cert.URIs)+len(cert.IPAddresses)+len(cert.EmailAddresses))
+	sans = append(sans, cert.DNSNames...)
+	for _, u := range cert.URIs {
+		sans = append(sans, u.String())
+	}
+	for _, ip := range cert.IPAddresses {
+		sans = append(sans, ip.String())
+	}
+	sans = append(sans, cert.EmailAddresses...)
+	return sans
+}
+
+func matchSAN(allowed []string, san string) bool {
+	for _, a := range allowed {
+		if prefix, ok := strings.CutSuffix(a, "*"); ok {
+			if strings.HasPrefix(san, prefix) {
+				return true
+			}
+			continue
+		}
+		if a == san {
+			return true
+		}
+	}
+	return false
+}
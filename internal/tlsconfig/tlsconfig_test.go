@@ -0,0 +1,261 @@
+package tlsconfig
+
+import (
+	"cartService/internal/jsonlog"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"math/big"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type authority struct {
+	cert *x509.Certificate
+	key  *ecdsa.PrivateKey
+	pem  []byte
+}
+
+func newAuthority(t *testing.T) authority {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test CA"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return authority{cert: cert, key: key, pem: pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})}
+}
+
+// issue signs a leaf certificate for both server and client use and returns it and
+// its key as PEM.
+func (a authority) issue(t *testing.T, serial int64, dnsName, uri string) (certPEM, keyPEM []byte) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(serial),
+		Subject:      pkix.Name{CommonName: dnsName},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		DNSNames:     []string{dnsName},
+	}
+	if uri != "" {
+		u, err := url.Parse(uri)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tmpl.URIs = []*url.URL{u}
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, a.cert, &key.PublicKey, a.key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: rawKey})
+}
+
+func writeFile(t *testing.T, path string, data []byte, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// serve accepts TLS connections on a loopback port and writes "ok" on every one that
+// completes the handshake.
+func serve(t *testing.T, cfg *tls.Config) string {
+	t.Helper()
+	ln, err := tls.Listen("tcp", "127.0.0.1:0", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ln.Close() })
+
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				conn.SetDeadline(time.Now().Add(5 * time.Second))
+				if conn.(*tls.Conn).Handshake() == nil {
+					conn.Write([]byte("ok"))
+				}
+			}()
+		}
+	}()
+	return ln.Addr().String()
+}
+
+// dial connects to addr and returns the server certificate once the server has
+// accepted the connection.
+func dial(addr string, cfg *tls.Config) (*x509.Certificate, error) {
+	conn, err := tls.Dial("tcp", addr, cfg)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+
+	// With TLS 1.3 a rejected client certificate only shows on the first read.
+	if _, err := io.ReadFull(conn, make([]byte, 2)); err != nil {
+		return nil, err
+	}
+	return conn.ConnectionState().PeerCertificates[0], nil
+}
+
+func TestMutualTLSWithReload(t *testing.T) {
+	dir := t.TempDir()
+	ca := newAuthority(t)
+	modTime := time.Now()
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	writeFile(t, path("ca.pem"), ca.pem, modTime)
+	certPEM, keyPEM := ca.issue(t, 10, "cart.local", "")
+	writeFile(t, path("server.pem"), certPEM, modTime)
+	writeFile(t, path("server.key"), keyPEM, modTime)
+	certPEM, keyPEM = ca.issue(t, 20, "api.local", "spiffe://cluster.local/ns/shop/sa/api")
+	writeFile(t, path("client.pem"), certPEM, modTime)
+	writeFile(t, path("client.key"), keyPEM, modTime)
+
+	server, err := NewReloader(Config{
+		CertFile:    path("server.pem"),
+		KeyFile:     path("server.key"),
+		CAFile:      path("ca.pem"),
+		AllowedSANs: []string{"spiffe://cluster.local/ns/shop/*"},
+	})
+	if err != nil {
+		t.Fatalf("server NewReloader: %v", err)
+	}
+	client, err := NewReloader(Config{
+		CertFile:   path("client.pem"),
+		KeyFile:    path("client.key"),
+		CAFile:     path("ca.pem"),
+		ServerName: "cart.local",
+	})
+	if err != nil {
+		t.Fatalf("client NewReloader: %v", err)
+	}
+	addr := serve(t, server.ServerConfig())
+
+	cert, err := dial(addr, client.ClientConfig())
+	if err != nil {
+		t.Fatalf("mTLS handshake: %v", err)
+	}
+	if cert.SerialNumber.Int64() != 10 {
+		t.Fatalf("server presented certificate %d, want 10", cert.SerialNumber)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go server.Watch(ctx, jsonlog.New(io.Discard, jsonlog.LevelOff), 10*time.Millisecond)
+
+	certPEM, keyPEM = ca.issue(t, 11, "cart.local", "")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		// Bump the modification time on every try: the watcher only compares
+		// against the files as they were when it started.
+		modTime = modTime.Add(time.Second)
+		writeFile(t, path("server.pem"), certPEM, modTime)
+		writeFile(t, path("server.key"), keyPEM, modTime)
+
+		cert, err := dial(addr, client.ClientConfig())
+		if err != nil {
+			t.Fatalf("handshake after the certificate was replaced: %v", err)
+		}
+		if cert.SerialNumber.Int64() == 11 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server still presents certificate %d after the files were replaced", cert.SerialNumber)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestMutualTLSRejectsClients(t *testing.T) {
+	dir := t.TempDir()
+	ca, other := newAuthority(t), newAuthority(t)
+	modTime := time.Now()
+	path := func(name string) string { return filepath.Join(dir, name) }
+
+	writeFile(t, path("ca.pem"), ca.pem, modTime)
+	certPEM, keyPEM := ca.issue(t, 10, "cart.local", "")
+	writeFile(t, path("server.pem"), certPEM, modTime)
+	writeFile(t, path("server.key"), keyPEM, modTime)
+	certPEM, keyPEM = other.issue(t, 20, "api.local", "spiffe://cluster.local/ns/shop/sa/api")
+	writeFile(t, path("stranger.pem"), certPEM, modTime)
+	writeFile(t, path("stranger.key"), keyPEM, modTime)
+	certPEM, keyPEM = ca.issue(t, 30, "batch.local", "spiffe://cluster.local/ns/batch/sa/job")
+	writeFile(t, path("batch.pem"), certPEM, modTime)
+	writeFile(t, path("batch.key"), keyPEM, modTime)
+
+	server, err := NewReloader(Config{
+		CertFile:    path("server.pem"),
+		KeyFile:     path("server.key"),
+		CAFile:      path("ca.pem"),
+		AllowedSANs: []string{"spiffe://cluster.local/ns/shop/*"},
+	})
+	if err != nil {
+		t.Fatalf("NewReloader: %v", err)
+	}
+	addr := serve(t, server.ServerConfig())
+
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"no certificate", Config{CAFile: path("ca.pem"), ServerName: "cart.local"}},
+		{"certificate of another CA", Config{CertFile: path("stranger.pem"), KeyFile: path("stranger.key"), CAFile: path("ca.pem"), ServerName: "cart.local"}},
+		{"identity not allowed", Config{CertFile: path("batch.pem"), KeyFile: path("batch.key"), CAFile: path("ca.pem"), ServerName: "cart.local"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			client, err := NewReloader(tt.cfg)
+			if err != nil {
+				t.Fatalf("NewReloader: %v", err)
+			}
+			if _, err := dial(addr, client.ClientConfig()); err == nil {
+				t.Fatal("server accepted the client")
+			}
+		})
+	}
+}
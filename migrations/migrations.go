@@ -0,0 +1,9 @@
+package migrations
+
+import "embed"
+
+// FS holds the SQL migrations in golang-migrate naming format
+// (<version>_<name>.up.sql / <version>_<name>.down.sql) so they ship inside the binary.
+//
+//go:embed *.sql
+var FS embed.FS
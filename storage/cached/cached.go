@@ -0,0 +1,216 @@
+package cached
+
+import (
+	"cartService/internal/cache"
+	"cartService/internal/data"
+	"cartService/internal/jsonlog"
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand/v2"
+	"strconv"
+	"sync"
+	"time"
+
+	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
+)
+
+const keyPrefix = "cart:v1:"
+
+type provider interface {
+	AddToCart(ctx context.Context, toy data.CartItem, userID int64) (cart_v1_crt.OperationStatus, string)
+	DelFromCart(ctx context.Context, toyId int64, userID int64) (cart_v1_crt.OperationStatus, string)
+	ClearCart(ctx context.Context, userID int64) (cart_v1_crt.OperationStatus, string)
+	GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32)
+	Watch(ctx context.Context, userID int64) (<-chan struct{}, func())
+	Ping(ctx context.Context) error
+	Close() error
+}
+
+// Storage is a read-through cache in front of another storage backend. GetCart is
+// served from the cache when possible; every mutation drops the user's entry.
+//
+// Entries are versioned: a version key names the user's current entry and a mutation
+// replaces the version rather than deleting the entry. A GetCart that read the cart
+// before a concurrent write can then only cache it under a version nobody reads again,
+// instead of serving the old cart until the TTL expires.
+type Storage struct {
+	next  provider
+	cache cache.Cache
+	ttl   time.Duration
+	log   *jsonlog.Logger
+}
+
+type cartEntry struct {
+	Items      []*data.CartItem `json:"items"`
+	TotalItems int32            `json:"total_items"`
+	TotalQty   int32            `json:"total_qty"`
+}
+
+func New(log *jsonlog.Logger, next provider, c cache.Cache, ttl time.Duration) *Storage {
+	return &Storage{
+		next:  next,
+		cache: c,
+		ttl:   ttl,
+		log:   log,
+	}
+}
+
+func (s *Storage) Close() error {
+	cacheErr := s.cache.Close()
+	if err := s.next.Close(); err != nil {
+		return err
+	}
+	return cacheErr
+}
+
+// Ping checks the underlying storage only: GetCart falls back to it when the cache
+// is unavailable, so a cache outage doesn't make the service unready.
+func (s *Storage) Ping(ctx context.Context) error {
+	return s.next.Ping(ctx)
+}
+
+func (s *Storage) AddToCart(ctx context.Context, toy data.CartItem, userID int64) (cart_v1_crt.OperationStatus, string) {
+	opStatus, msg := s.next.AddToCart(ctx, toy, userID)
+	s.invalidate(ctx, userID)
+	return opStatus, msg
+}
+
+func (s *Storage) DelFromCart(ctx context.Context, toyId int64, userID int64) (cart_v1_crt.OperationStatus, string) {
+	opStatus, msg := s.next.DelFromCart(ctx, toyId, userID)
+	s.invalidate(ctx, userID)
+	return opStatus, msg
+}
+
+func (s *Storage) ClearCart(ctx context.Context, userID int64) (cart_v1_crt.OperationStatus, string) {
+	opStatus, msg := s.next.ClearCart(ctx, userID)
+	s.invalidate(ctx, userID)
+	return opStatus, msg
+}
+
+// Watch drops the user's entry on every change signal before passing it on: the
+// change may have been made through another replica, which can't reach this cache.
+func (s *Storage) Watch(ctx context.Context, userID int64) (<-chan struct{}, func()) {
+	changes, stop := s.next.Watch(ctx, userID)
+
+	out := make(chan struct{}, 1)
+	done := make(chan struct{})
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case <-changes:
+				s.invalidate(ctx, userID)
+				select {
+				case out <- struct{}{}:
+				default:
+				}
+			}
+		}
+	}()
+
+	var once sync.Once
+	return out, func() {
+		once.Do(func() {
+			stop()
+			close(done)
+		})
+	}
+}
+
+func (s *Storage) GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32) {
+	version, err := s.version(ctx, userID)
+	if err != nil {
+		s.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "cached.GetCart",
+			"user":   strconv.FormatInt(userID, 10),
+		})
+		return s.next.GetCart(ctx, userID)
+	}
+	key := cartKey(userID, version)
+
+	raw, err := s.cache.Get(ctx, key)
+	switch {
+	case err == nil:
+		var entry cartEntry
+		if err := json.Unmarshal(raw, &entry); err == nil {
+			return entry.Items, entry.TotalItems, entry.TotalQty
+		}
+		s.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "cached.GetCart",
+			"key":    key,
+		})
+	case !errors.Is(err, cache.ErrMiss):
+		s.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "cached.GetCart",
+			"key":    key,
+		})
+	}
+
+	toys, totalItems, totalQty := s.next.GetCart(ctx, userID)
+
+	// The storages report a failed read as a nil cart, which is never cached so an
+	// error is not pinned for the whole TTL.
+	if toys == nil {
+		return toys, totalItems, totalQty
+	}
+
+	raw, err = json.Marshal(cartEntry{
+		Items:      toys,
+		TotalItems: totalItems,
+		TotalQty:   totalQty,
+	})
+	if err == nil {
+		err = s.cache.Set(ctx, key, raw, s.ttl)
+	}
+	if err != nil {
+		s.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "cached.GetCart",
+			"key":    key,
+		})
+	}
+
+	return toys, totalItems, totalQty
+}
+
+// version returns the version naming the user's current entry. A missing version,
+// never set or expired, is replaced by a new one: its entry can't exist yet.
+func (s *Storage) version(ctx context.Context, userID int64) (string, error) {
+	raw, err := s.cache.Get(ctx, versionKey(userID))
+	if err == nil {
+		return string(raw), nil
+	}
+	if !errors.Is(err, cache.ErrMiss) {
+		return "", err
+	}
+
+	version := newVersion()
+	if err := s.cache.Set(ctx, versionKey(userID), []byte(version), s.ttl); err != nil {
+		return "", err
+	}
+	return version, nil
+}
+
+// invalidate moves the user to a new version, orphaning the current entry; it
+// expires with its TTL.
+func (s *Storage) invalidate(ctx context.Context, userID int64) {
+	if err := s.cache.Set(ctx, versionKey(userID), []byte(newVersion()), s.ttl); err != nil {
+		s.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "cached.invalidate",
+			"user":   strconv.FormatInt(userID, 10),
+		})
+	}
+}
+
+func newVersion() string {
+	return strconv.FormatUint(rand.Uint64(), 36)
+}
+
+func versionKey(userID int64) string {
+	return keyPrefix + "version:" + strconv.FormatInt(userID, 10)
+}
+
+func cartKey(userID int64, version string) string {
+	return keyPrefix + strconv.FormatInt(userID, 10) + ":" + version
+}
@@ -0,0 +1,102 @@
+package cached
+
+import (
+	"cartService/internal/cache"
+	"cartService/internal/data"
+	"cartService/internal/jsonlog"
+	"cartService/storage/memory"
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func newStorage(t *testing.T) (*Storage, *memory.Storage) {
+	t.Helper()
+	next := memory.New()
+	s := New(jsonlog.New(io.Discard, jsonlog.LevelInfo), next, cache.NewLRU(100), time.Hour)
+	t.Cleanup(func() { s.Close() })
+	return s, next
+}
+
+func TestWatchInvalidatesBeforeSignalling(t *testing.T) {
+	s, next := newStorage(t)
+	ctx := context.Background()
+
+	s.AddToCart(ctx, data.CartItem{ToyID: 1, Quantity: 1}, 7)
+	if _, _, qty := s.GetCart(ctx, 7); qty != 1 {
+		t.Fatalf("GetCart quantity = %d, want 1", qty)
+	}
+
+	changes, stop := s.Watch(ctx, 7)
+	defer stop()
+
+	// A write through another replica reaches this one only as a change signal.
+	next.AddToCart(ctx, data.CartItem{ToyID: 1, Quantity: 2}, 7)
+
+	select {
+	case <-changes:
+	case <-time.After(time.Second):
+		t.Fatal("no change signal")
+	}
+	if _, _, qty := s.GetCart(ctx, 7); qty != 3 {
+		t.Fatalf("GetCart quantity after the signal = %d, want 3", qty)
+	}
+}
+
+// slowReads holds every GetCart after it has read the cart until release is closed.
+type slowReads struct {
+	*memory.Storage
+	read    chan struct{}
+	release chan struct{}
+}
+
+func (s *slowReads) GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32) {
+	toys, totalItems, totalQty := s.Storage.GetCart(ctx, userID)
+	s.read <- struct{}{}
+	<-s.release
+	return toys, totalItems, totalQty
+}
+
+func TestGetCartRacingAWriteDoesNotCacheTheOldCart(t *testing.T) {
+	next := &slowReads{Storage: memory.New(), read: make(chan struct{}, 1), release: make(chan struct{})}
+	s := New(jsonlog.New(io.Discard, jsonlog.LevelInfo), next, cache.NewLRU(100), time.Hour)
+	ctx := context.Background()
+
+	next.Storage.AddToCart(ctx, data.CartItem{ToyID: 1, Quantity: 1}, 7)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		s.GetCart(ctx, 7)
+	}()
+	<-next.read
+
+	// The write lands after the read above saw the old cart but before it is cached.
+	s.AddToCart(ctx, data.CartItem{ToyID: 1, Quantity: 4}, 7)
+	close(next.release)
+	<-done
+
+	if _, _, qty := s.GetCart(ctx, 7); qty != 5 {
+		t.Fatalf("GetCart quantity = %d, want 5", qty)
+	}
+}
+
+func TestGetCartServesCachedEntryUntilAWrite(t *testing.T) {
+	s, next := newStorage(t)
+	ctx := context.Background()
+
+	s.AddToCart(ctx, data.CartItem{ToyID: 1, Quantity: 1}, 7)
+	s.GetCart(ctx, 7)
+
+	// Written around the cache: the cached entry is still served.
+	next.AddToCart(ctx, data.CartItem{ToyID: 2, Quantity: 1}, 7)
+	if _, totalItems, _ := s.GetCart(ctx, 7); totalItems != 1 {
+		t.Fatalf("GetCart items = %d, want the cached 1", totalItems)
+	}
+
+	s.DelFromCart(ctx, 1, 7)
+	if toys, _, _ := s.GetCart(ctx, 7); len(toys) != 1 || toys[0].ToyID != 2 {
+		t.Fatalf("GetCart after DelFromCart = %v, want toy 2 only", toys)
+	}
+}
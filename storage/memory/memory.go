@@ -0,0 +1,137 @@
+package memory
+
+import (
+	"cartService/internal/data"
+	"cartService/internal/notify"
+	"context"
+	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
+	"sync"
+)
+
+// Storage keeps carts in process memory. It mirrors the behaviour of postgres.Storage,
+// including the quantity upsert and the positive user id / quantity constraints, so the
+// service can run without a database.
+type Storage struct {
+	mu    sync.RWMutex
+	carts map[int64]*cart
+	hub   *notify.Hub
+}
+
+type cart struct {
+	items []*data.CartItem
+}
+
+func New() *Storage {
+	return &Storage{
+		carts: make(map[int64]*cart),
+		hub:   notify.NewHub(),
+	}
+}
+
+func (s *Storage) Close() error {
+	return nil
+}
+
+// Ping always succeeds; it exists so the memory backend can stand in for postgres.
+func (s *Storage) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (s *Storage) AddToCart(ctx context.Context, toy data.CartItem, userID int64) (cart_v1_crt.OperationStatus, string) {
+	if userID <= 0 {
+		return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "failed to get user cart"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.carts[userID]
+	if !ok {
+		c = &cart{}
+		s.carts[userID] = c
+	}
+
+	for _, item := range c.items {
+		if item.ToyID == toy.ToyID {
+			if item.Quantity+toy.Quantity <= 0 {
+				return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "failed to add toy"
+			}
+			item.Quantity += toy.Quantity
+			s.hub.Publish(userID)
+			return cart_v1_crt.OperationStatus_STATUS_OK, "Toy added to a cart!"
+		}
+	}
+
+	if toy.Quantity <= 0 {
+		return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "failed to add toy"
+	}
+	c.items = append(c.items, &data.CartItem{
+		ToyID:    toy.ToyID,
+		Quantity: toy.Quantity,
+	})
+
+	s.hub.Publish(userID)
+	return cart_v1_crt.OperationStatus_STATUS_OK, "Toy added to a cart!"
+}
+
+func (s *Storage) DelFromCart(ctx context.Context, toyId int64, userID int64) (cart_v1_crt.OperationStatus, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.carts[userID]
+	if !ok {
+		return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "failed to delete toy!"
+	}
+
+	for i, item := range c.items {
+		if item.ToyID == toyId {
+			c.items = append(c.items[:i], c.items[i+1:]...)
+			s.hub.Publish(userID)
+			return cart_v1_crt.OperationStatus_STATUS_OK, "deleted successfully"
+		}
+	}
+
+	return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "failed to delete toy!"
+}
+
+func (s *Storage) ClearCart(ctx context.Context, userID int64) (cart_v1_crt.OperationStatus, string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	c, ok := s.carts[userID]
+	if !ok || len(c.items) == 0 {
+		return cart_v1_crt.OperationStatus_STATUS_CART_EMPTY, "cart is already empty"
+	}
+
+	c.items = nil
+	s.hub.Publish(userID)
+	return cart_v1_crt.OperationStatus_STATUS_OK, "cart cleared"
+}
+
+// Watch returns a channel signalled whenever the cart of userID changes and a function
+// releasing the subscription.
+func (s *Storage) Watch(ctx context.Context, userID int64) (<-chan struct{}, func()) {
+	return s.hub.Subscribe(userID)
+}
+
+func (s *Storage) GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	toys := []*data.CartItem{}
+
+	c, ok := s.carts[userID]
+	if !ok {
+		return toys, 0, 0
+	}
+
+	var totalQty int32
+	for _, item := range c.items {
+		// Hand out copies so callers can't mutate the stored items without the lock.
+		toy := *item
+		toys = append(toys, &toy)
+		totalQty += item.Quantity
+	}
+
+	return toys, int32(len(toys)), totalQty
+}
@@ -0,0 +1,172 @@
+package memory
+
+import (
+	"cartService/internal/data"
+	"context"
+	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
+	"reflect"
+	"testing"
+)
+
+// op is one storage call of a test case; only the fields its kind uses are set.
+type op struct {
+	kind   string // "add", "del" or "clear"
+	userID int64
+	toyID  int64
+	qty    int32
+	want   cart_v1_crt.OperationStatus
+}
+
+func TestStorage(t *testing.T) {
+	const (
+		ok       = cart_v1_crt.OperationStatus_STATUS_OK
+		failed   = cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR
+		empty    = cart_v1_crt.OperationStatus_STATUS_CART_EMPTY
+		user     = int64(1)
+		neighbor = int64(2)
+	)
+
+	tests := []struct {
+		name      string
+		ops       []op
+		wantItems []*data.CartItem
+		wantQty   int32
+	}{
+		{
+			name:      "add",
+			ops:       []op{{kind: "add", userID: user, toyID: 10, qty: 2, want: ok}},
+			wantItems: []*data.CartItem{{ToyID: 10, Quantity: 2}},
+			wantQty:   2,
+		},
+		{
+			name: "duplicate add sums quantities",
+			ops: []op{
+				{kind: "add", userID: user, toyID: 10, qty: 2, want: ok},
+				{kind: "add", userID: user, toyID: 10, qty: 3, want: ok},
+			},
+			wantItems: []*data.CartItem{{ToyID: 10, Quantity: 5}},
+			wantQty:   5,
+		},
+		{
+			name: "add keeps quantities positive",
+			ops: []op{
+				{kind: "add", userID: user, toyID: 10, qty: 0, want: failed},
+				{kind: "add", userID: user, toyID: 20, qty: 2, want: ok},
+				{kind: "add", userID: user, toyID: 20, qty: -2, want: failed},
+			},
+			wantItems: []*data.CartItem{{ToyID: 20, Quantity: 2}},
+			wantQty:   2,
+		},
+		{
+			name:      "add needs a positive user id",
+			ops:       []op{{kind: "add", userID: 0, toyID: 10, qty: 1, want: failed}},
+			wantItems: []*data.CartItem{},
+		},
+		{
+			name: "delete",
+			ops: []op{
+				{kind: "add", userID: user, toyID: 10, qty: 1, want: ok},
+				{kind: "add", userID: user, toyID: 20, qty: 4, want: ok},
+				{kind: "del", userID: user, toyID: 10, want: ok},
+			},
+			wantItems: []*data.CartItem{{ToyID: 20, Quantity: 4}},
+			wantQty:   4,
+		},
+		{
+			name: "delete of a missing item",
+			ops: []op{
+				{kind: "del", userID: user, toyID: 10, want: failed},
+				{kind: "add", userID: user, toyID: 20, qty: 1, want: ok},
+				{kind: "del", userID: user, toyID: 10, want: failed},
+			},
+			wantItems: []*data.CartItem{{ToyID: 20, Quantity: 1}},
+			wantQty:   1,
+		},
+		{
+			name: "clear",
+			ops: []op{
+				{kind: "clear", userID: user, want: empty},
+				{kind: "add", userID: user, toyID: 10, qty: 1, want: ok},
+				{kind: "add", userID: user, toyID: 20, qty: 1, want: ok},
+				{kind: "clear", userID: user, want: ok},
+				{kind: "clear", userID: user, want: empty},
+			},
+			wantItems: []*data.CartItem{},
+		},
+		{
+			name: "carts are per user",
+			ops: []op{
+				{kind: "add", userID: neighbor, toyID: 10, qty: 7, want: ok},
+				{kind: "add", userID: user, toyID: 30, qty: 1, want: ok},
+				{kind: "add", userID: user, toyID: 40, qty: 2, want: ok},
+				{kind: "clear", userID: neighbor, want: ok},
+			},
+			wantItems: []*data.CartItem{{ToyID: 30, Quantity: 1}, {ToyID: 40, Quantity: 2}},
+			wantQty:   3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := New()
+
+			for i, o := range tt.ops {
+				var got cart_v1_crt.OperationStatus
+				switch o.kind {
+				case "add":
+					got, _ = s.AddToCart(ctx, data.CartItem{ToyID: o.toyID, Quantity: o.qty}, o.userID)
+				case "del":
+					got, _ = s.DelFromCart(ctx, o.toyID, o.userID)
+				case "clear":
+					got, _ = s.ClearCart(ctx, o.userID)
+				}
+				if got != o.want {
+					t.Fatalf("op %d (%s toy %d): status %s, want %s", i, o.kind, o.toyID, got, o.want)
+				}
+			}
+
+			items, count, qty := s.GetCart(ctx, user)
+			if !reflect.DeepEqual(items, tt.wantItems) {
+				t.Errorf("items = %v, want %v", items, tt.wantItems)
+			}
+			if count != int32(len(tt.wantItems)) || qty != tt.wantQty {
+				t.Errorf("totals = %d items, %d toys, want %d, %d", count, qty, len(tt.wantItems), tt.wantQty)
+			}
+		})
+	}
+}
+
+func TestGetCartReturnsCopies(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	s.AddToCart(ctx, data.CartItem{ToyID: 10, Quantity: 1}, 1)
+
+	items, _, _ := s.GetCart(ctx, 1)
+	items[0].Quantity = 99
+
+	if items, _, _ := s.GetCart(ctx, 1); items[0].Quantity != 1 {
+		t.Fatalf("stored quantity changed to %d through a returned item", items[0].Quantity)
+	}
+}
+
+func TestWatch(t *testing.T) {
+	ctx := context.Background()
+	s := New()
+	changes, stop := s.Watch(ctx, 1)
+	defer stop()
+
+	s.AddToCart(ctx, data.CartItem{ToyID: 10, Quantity: 1}, 2)
+	select {
+	case <-changes:
+		t.Fatal("signalled for another user's cart")
+	default:
+	}
+
+	s.AddToCart(ctx, data.CartItem{ToyID: 10, Quantity: 1}, 1)
+	select {
+	case <-changes:
+	default:
+		t.Fatal("not signalled after a change")
+	}
+}
@@ -0,0 +1,80 @@
+package postgres
+
+import (
+	"cartService/migrations"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"000010_add_index.up.sql":      {Data: []byte("CREATE INDEX i ON t (c);")},
+		"000002_create_table.up.sql":   {Data: []byte("CREATE TABLE t (c int);")},
+		"000002_create_table.down.sql": {Data: []byte("DROP TABLE t;")},
+		"000001_noop_up_only.up.sql":   {Data: []byte("SELECT 1;")},
+		"README.md":                    {Data: []byte("not a migration")},
+		"old/000003_skipped.up.sql":    {Data: []byte("not read")},
+	}
+
+	got, err := LoadMigrations(fsys)
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+
+	want := []Migration{
+		{Version: 1, Name: "noop_up_only", Up: "SELECT 1;"},
+		{Version: 2, Name: "create_table", Up: "CREATE TABLE t (c int);", Down: "DROP TABLE t;"},
+		{Version: 10, Name: "add_index", Up: "CREATE INDEX i ON t (c);"},
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d migrations, want %d: %+v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("migration %d = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestLoadMigrationsErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		file string
+		data string
+		want string
+	}{
+		{"no direction", "000001_create.sql", "SELECT 1;", "malformed migration file name"},
+		{"unknown direction", "000001_create.sideways.sql", "SELECT 1;", "malformed migration file name"},
+		{"no name", "000001.up.sql", "SELECT 1;", "malformed migration file name"},
+		{"bad version", "first_create.up.sql", "SELECT 1;", "malformed migration version"},
+		{"down only", "000001_create.down.sql", "SELECT 1;", "has no up script"},
+		{"empty up", "000001_create.up.sql", "", "has no up script"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := LoadMigrations(fstest.MapFS{tt.file: {Data: []byte(tt.data)}})
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("LoadMigrations(%s) = %v, want an error containing %q", tt.file, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestEmbeddedMigrations(t *testing.T) {
+	got, err := LoadMigrations(migrations.FS)
+	if err != nil {
+		t.Fatalf("LoadMigrations: %v", err)
+	}
+	if len(got) == 0 {
+		t.Fatal("no embedded migrations")
+	}
+	for i, m := range got {
+		if m.Down == "" {
+			t.Errorf("migration %d_%s has no down script", m.Version, m.Name)
+		}
+		if i > 0 && got[i-1].Version >= m.Version {
+			t.Errorf("migration %d listed after %d", m.Version, got[i-1].Version)
+		}
+	}
+}
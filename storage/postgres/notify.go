@@ -0,0 +1,68 @@
+package postgres
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// cartChangesChannel is the LISTEN/NOTIFY channel every mutation publishes the user id
+// on, so that WatchCart streams on all replicas see changes made through any of them.
+const cartChangesChannel = "cart_changes"
+
+func (s *Storage) notifyChange(ctx context.Context, userID int64) {
+	_, err := s.execContext(ctx, "SELECT pg_notify", `SELECT pg_notify($1, $2)`, cartChangesChannel, strconv.FormatInt(userID, 10))
+	if err != nil {
+		s.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "postgres.notifyChange",
+		})
+	}
+}
+
+// Watch returns a channel signalled whenever the cart of userID changes and a function
+// releasing the subscription. The LISTEN connection is opened on first use.
+func (s *Storage) Watch(ctx context.Context, userID int64) (<-chan struct{}, func()) {
+	s.listenOnce.Do(s.startListener)
+	return s.hub.Subscribe(userID)
+}
+
+func (s *Storage) startListener() {
+	s.listener = pq.NewListener(s.dsn, time.Second, time.Minute, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			s.log.PrintError(err, map[string]string{
+				"method": "postgres.startListener",
+			})
+		}
+	})
+	if err := s.listener.Listen(cartChangesChannel); err != nil {
+		s.log.PrintError(err, map[string]string{
+			"method": "postgres.startListener",
+		})
+	}
+
+	go func() {
+		for {
+			select {
+			case n, ok := <-s.listener.NotificationChannel():
+				if !ok {
+					return
+				}
+				// A nil notification means the connection was re-established and
+				// changes may have been missed; let every watcher re-read.
+				if n == nil {
+					s.hub.PublishAll()
+					continue
+				}
+				userID, err := strconv.ParseInt(n.Extra, 10, 64)
+				if err != nil {
+					continue
+				}
+				s.hub.Publish(userID)
+			case <-time.After(90 * time.Second):
+				go s.listener.Ping()
+			}
+		}
+	}()
+}
@@ -2,18 +2,30 @@ package postgres
 
 import (
 	"cartService/internal/data"
+	"cartService/internal/jsonlog"
+	"cartService/internal/notify"
 	"cartService/internal/validator"
+	"cartService/migrations"
 	"context"
 	"database/sql"
 	"errors"
-	_ "github.com/lib/pq"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
 	cart_v1_crt "github.com/spacecowboytobykty123/protoCart/proto/gen/go/cart"
-	"log"
+	"sync"
 	"time"
 )
 
 type Storage struct {
-	db *sql.DB
+	db  *sql.DB
+	dsn string
+	hub *notify.Hub
+	log *jsonlog.Logger
+
+	listenOnce sync.Once
+	listener   *pq.Listener
 }
 
 const (
@@ -25,9 +37,16 @@ type StorageDetails struct {
 	MaxOpenConns int
 	MaxIdleConns int
 	MaxIdleTime  string
+	AutoMigrate  bool
+	// MigrateTimeout bounds the startup migrations, waiting for the lock included;
+	// zero means defaultMigrateTimeout.
+	MigrateTimeout time.Duration
 }
 
-func OpenDB(details StorageDetails) (*Storage, error) {
+// defaultMigrateTimeout matches the -timeout default of the migrate command.
+const defaultMigrateTimeout = 5 * time.Minute
+
+func OpenDB(logger *jsonlog.Logger, details StorageDetails) (*Storage, error) {
 	var db *sql.DB
 	var err error
 	for i := 0; i < 10; i++ {
@@ -38,23 +57,28 @@ func OpenDB(details StorageDetails) (*Storage, error) {
 		if err == nil {
 			break
 		}
+		if db != nil {
+			db.Close()
+		}
 		time.Sleep(2 * time.Second)
-		log.Printf("retrying DB connection... (%d/10)", i+1)
+		logger.Log(jsonlog.LevelInfo, "retrying DB connection",
+			jsonlog.String("method", "postgres.OpenDB"),
+			jsonlog.Int("attempt", i+1),
+			jsonlog.Int("max_attempts", 10),
+		)
 	}
-
 	if err != nil {
-
-		log.Fatal("failed to connect to database after retries:", err)
+		return nil, fmt.Errorf("%s: failed to connect to database after retries: %w", "postgres.OpenDB", err)
 	}
 
-	if err != nil {
-		return nil, err
-	}
 	db.SetMaxOpenConns(details.MaxOpenConns)
 	db.SetMaxIdleConns(details.MaxIdleConns)
 
 	duration, err := time.ParseDuration(details.MaxIdleTime)
-
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%s: %w", "postgres.OpenDB", err)
+	}
 	db.SetConnMaxIdleTime(duration)
 
 	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
@@ -62,11 +86,45 @@ func OpenDB(details StorageDetails) (*Storage, error) {
 
 	err = db.PingContext(ctx)
 	if err != nil {
+		db.Close()
 		return nil, err
 	}
-	return &Storage{
-		db: db,
-	}, err
+
+	storage := &Storage{
+		db:  db,
+		dsn: details.DSN,
+		hub: notify.NewHub(),
+		log: logger,
+	}
+
+	if details.AutoMigrate {
+		migrator, err := NewMigrator(storage, migrations.FS)
+		if err != nil {
+			db.Close()
+			return nil, err
+		}
+		timeout := details.MigrateTimeout
+		if timeout <= 0 {
+			timeout = defaultMigrateTimeout
+		}
+		migrateCtx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+
+		applied, err := migrator.Up(migrateCtx)
+		if err != nil {
+			db.Close()
+			if migrateCtx.Err() != nil {
+				return nil, fmt.Errorf("%s: migrations did not finish within %s; another instance may hold the migration lock: %w", "postgres.OpenDB", timeout, err)
+			}
+			return nil, err
+		}
+		logger.Log(jsonlog.LevelInfo, "migrations applied",
+			jsonlog.String("method", "postgres.OpenDB"),
+			jsonlog.Int("applied", applied),
+		)
+	}
+
+	return storage, nil
 }
 
 func ValidateToy(v *validator.Validator, toy data.CartItem) {
@@ -75,9 +133,26 @@ func ValidateToy(v *validator.Validator, toy data.CartItem) {
 }
 
 func (s *Storage) Close() error {
+	if s.listener != nil {
+		s.listener.Close()
+	}
 	return s.db.Close()
 }
 
+// Ping checks that the database is reachable.
+func (s *Storage) Ping(ctx context.Context) error {
+	if err := s.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%s: %w", "postgres.Ping", err)
+	}
+	return nil
+}
+
+// PoolCollector exports the connection pool statistics of sql.DB.Stats as the
+// go_sql_* metrics with db_name="cart".
+func (s *Storage) PoolCollector() prometheus.Collector {
+	return collectors.NewDBStatsCollector(s.db, "cart")
+}
+
 func (s *Storage) AddToCart(ctx context.Context, toy data.CartItem, userID int64) (cart_v1_crt.OperationStatus, string) {
 	query := `INSERT INTO cart_items (user_id, toy_id, quantity)
 VALUES ($1, $2, $3)
@@ -92,21 +167,23 @@ RETURNING id;
 VALUES ($1)
 ON CONFLICT (user_id) DO NOTHING;`
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	// Queries outlive a cancelled caller but keep its trace.
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
 	defer cancel()
 
-	_, err := s.db.ExecContext(ctx, query1, userID)
+	_, err := s.execContext(ctx, "INSERT carts", query1, userID)
 	if err != nil {
 		return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "failed to get user cart"
 	}
 
 	var itemID int64
 	args := []any{userID, toy.ToyID, toy.Quantity}
-	println("db part")
 
-	err = s.db.QueryRowContext(ctx, query, args...).Scan(&itemID)
+	err = s.queryRowScan(ctx, "INSERT cart_items", query, args, &itemID)
 	if err != nil {
-		println(err.Error())
+		s.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "postgres.AddToCart",
+		})
 		switch {
 		case errors.Is(err, sql.ErrNoRows):
 			return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "failed to add toy"
@@ -115,6 +192,7 @@ ON CONFLICT (user_id) DO NOTHING;`
 		}
 	}
 
+	s.notifyChange(ctx, userID)
 	return cart_v1_crt.OperationStatus_STATUS_OK, "Toy added to a cart!"
 }
 
@@ -123,10 +201,10 @@ func (s *Storage) DelFromCart(ctx context.Context, toyId int64, userID int64) (c
 WHERE user_id = $1 AND toy_id = $2
 `
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
 	defer cancel()
 
-	results, err := s.db.ExecContext(ctx, query, userID, toyId)
+	results, err := s.execContext(ctx, "DELETE cart_items", query, userID, toyId)
 	if err != nil {
 		return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "failed to delete toy!"
 	}
@@ -138,23 +216,53 @@ WHERE user_id = $1 AND toy_id = $2
 	if rowsAffected == 0 {
 		return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "failed to delete toy!"
 	}
+
+	s.notifyChange(ctx, userID)
 	return cart_v1_crt.OperationStatus_STATUS_OK, "deleted successfully"
 
 }
 
+func (s *Storage) ClearCart(ctx context.Context, userID int64) (cart_v1_crt.OperationStatus, string) {
+	query := `DELETE FROM cart_items
+WHERE user_id = $1
+`
+
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
+	defer cancel()
+
+	results, err := s.execContext(ctx, "DELETE cart_items", query, userID)
+	if err != nil {
+		return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "failed to clear cart!"
+	}
+	rowsAffected, err := results.RowsAffected()
+	if err != nil {
+		return cart_v1_crt.OperationStatus_STATUS_INTERNAL_ERROR, "failed to clear cart!"
+	}
+
+	if rowsAffected == 0 {
+		return cart_v1_crt.OperationStatus_STATUS_CART_EMPTY, "cart is already empty"
+	}
+
+	s.notifyChange(ctx, userID)
+	return cart_v1_crt.OperationStatus_STATUS_OK, "cart cleared"
+}
+
+// GetCart reports a failed read as a nil cart, so it can be told apart from an empty
+// one.
 func (s *Storage) GetCart(ctx context.Context, userID int64) ([]*data.CartItem, int32, int32) {
 	query := `SELECT toy_id, quantity from cart_items
 WHERE user_id = $1
 `
 
-	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 3*time.Second)
 	defer cancel()
 
-	rows, err := s.db.QueryContext(ctx, query, userID)
+	rows, err := s.queryContext(ctx, "SELECT cart_items", query, userID)
 	if err != nil {
-		println("1")
-		println(err.Error())
-		return []*data.CartItem{}, 0, 0
+		s.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "postgres.GetCart",
+		})
+		return nil, 0, 0
 	}
 	defer rows.Close()
 
@@ -169,32 +277,40 @@ WHERE user_id = $1
 		)
 
 		if err != nil {
-			println("1")
-			println(err.Error())
-			return []*data.CartItem{}, 0, 0
+			s.log.PrintErrorContext(ctx, err, map[string]string{
+				"method": "postgres.GetCart",
+			})
+			return nil, 0, 0
 		}
 
 		toys = append(toys, &toy)
 	}
 
 	if err = rows.Err(); err != nil {
-		println("3")
-		println(err.Error())
-		return []*data.CartItem{}, 0, 0
+		s.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "postgres.GetCart",
+		})
+		return nil, 0, 0
 	}
 
 	var totalqty, totalToys int32
 
-	err = s.db.QueryRowContext(ctx, `SELECT COUNT(*) from cart_items WHERE user_id = $1`, userID).Scan(&totalToys)
+	err = s.queryRowScan(ctx, "SELECT cart_items", `SELECT COUNT(*) from cart_items WHERE user_id = $1`, []any{userID}, &totalToys)
 	if err != nil {
-		println("totalToys db part")
-		return []*data.CartItem{}, 0, 0
+		s.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "postgres.GetCart",
+			"query":  "count",
+		})
+		return nil, 0, 0
 	}
 
-	err = s.db.QueryRowContext(ctx, `SELECT SUM(quantity) FROM cart_items WHERE user_id=$1`, userID).Scan(&totalqty)
+	err = s.queryRowScan(ctx, "SELECT cart_items", `SELECT COALESCE(SUM(quantity), 0) FROM cart_items WHERE user_id=$1`, []any{userID}, &totalqty)
 	if err != nil {
-		println("totalToys qty db part")
-		return []*data.CartItem{}, 0, 0
+		s.log.PrintErrorContext(ctx, err, map[string]string{
+			"method": "postgres.GetCart",
+			"query":  "sum",
+		})
+		return nil, 0, 0
 	}
 	return toys, totalToys, totalqty
 }
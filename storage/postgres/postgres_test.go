@@ -0,0 +1,55 @@
+package postgres
+
+import (
+	"cartService/internal/jsonlog"
+	"context"
+	"database/sql"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestOpenDBGivesUpWaitingForMigrationLock(t *testing.T) {
+	dsn := os.Getenv("CART_TEST_DSN")
+	if dsn == "" {
+		t.Skip("CART_TEST_DSN not set")
+	}
+
+	// Another instance is busy migrating.
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	conn, err := db.Conn(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if _, err := conn.ExecContext(context.Background(), `SELECT pg_advisory_lock($1)`, migrationLockID); err != nil {
+		t.Fatal(err)
+	}
+	defer conn.ExecContext(context.Background(), `SELECT pg_advisory_unlock($1)`, migrationLockID)
+
+	start := time.Now()
+	storage, err := OpenDB(jsonlog.New(io.Discard, jsonlog.LevelOff), StorageDetails{
+		DSN:            dsn,
+		MaxOpenConns:   2,
+		MaxIdleConns:   2,
+		MaxIdleTime:    "1m",
+		AutoMigrate:    true,
+		MigrateTimeout: 200 * time.Millisecond,
+	})
+	if err == nil {
+		storage.Close()
+		t.Fatal("OpenDB succeeded while the migration lock was held")
+	}
+	if !strings.Contains(err.Error(), "migration lock") {
+		t.Fatalf("OpenDB: %v, want it to blame the migration lock", err)
+	}
+	if elapsed := time.Since(start); elapsed > 10*time.Second {
+		t.Fatalf("OpenDB gave up after %s", elapsed)
+	}
+}
@@ -0,0 +1,58 @@
+package postgres
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("cartService/storage/postgres")
+
+// The helpers below run one statement inside a client span named after the
+// operation, e.g. "DELETE cart_items". The query text is recorded with its
+// placeholders, never with the argument values.
+
+func (s *Storage) execContext(ctx context.Context, name, query string, args ...any) (sql.Result, error) {
+	ctx, span := startQuery(ctx, name, query)
+	res, err := s.db.ExecContext(ctx, query, args...)
+	endQuery(span, err)
+	return res, err
+}
+
+// queryContext only covers the query itself; reading the rows is not in the span.
+func (s *Storage) queryContext(ctx context.Context, name, query string, args ...any) (*sql.Rows, error) {
+	ctx, span := startQuery(ctx, name, query)
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	endQuery(span, err)
+	return rows, err
+}
+
+func (s *Storage) queryRowScan(ctx context.Context, name, query string, args []any, dest ...any) error {
+	ctx, span := startQuery(ctx, name, query)
+	err := s.db.QueryRowContext(ctx, query, args...).Scan(dest...)
+	endQuery(span, err)
+	return err
+}
+
+func startQuery(ctx context.Context, name, query string) (context.Context, trace.Span) {
+	return tracer.Start(ctx, name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			attribute.String("db.system", "postgresql"),
+			attribute.String("db.query.text", query),
+		),
+	)
+}
+
+func endQuery(span trace.Span, err error) {
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}